@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"review-products/database"
+	"review-products/models"
+)
+
+// API keys look like rpk_<prefix>_<secret>. The prefix is stored in clear
+// so a key can be found and recognised in listings; the whole key is only
+// stored hashed.
+const apiKeyTag = "rpk_"
+
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+var prefixEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// LooksLikeAPIKey tells bearer API keys apart from JWTs.
+func LooksLikeAPIKey(value string) bool {
+	return strings.HasPrefix(value, apiKeyTag)
+}
+
+// GenerateAPIKey returns the raw key to show once, its prefix and its hash.
+func GenerateAPIKey() (raw, prefix, hash string, err error) {
+	b := make([]byte, 5)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", "", err
+	}
+	prefix = prefixEncoding.EncodeToString(b)
+
+	secret, err := RandomToken(32)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	raw = apiKeyTag + prefix + "_" + secret
+	return raw, prefix, HashToken(raw), nil
+}
+
+// ValidateScopes checks that every scope is a permission the role holds,
+// so a key can never do more than its owner.
+func ValidateScopes(role string, scopes []string) error {
+	if len(scopes) == 0 {
+		return errors.New("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !Can(role, Permission(scope)) {
+			return errors.New("scope not allowed for your role: " + scope)
+		}
+	}
+	return nil
+}
+
+// AuthenticateAPIKey resolves raw to its key and owner. Revoked and expired
+// keys are rejected. LastUsedAt is updated at most once a minute.
+func AuthenticateAPIKey(raw string) (*models.APIKey, *models.User, error) {
+	rest, ok := strings.CutPrefix(raw, apiKeyTag)
+	if !ok {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	prefix, _, ok := strings.Cut(rest, "_")
+	if !ok {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	var key models.APIKey
+	if err := database.DB.Where("prefix = ?", prefix).First(&key).Error; err != nil {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	if subtle.ConstantTimeCompare([]byte(key.KeyHash), []byte(HashToken(raw))) != 1 {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && time.Now().After(*key.ExpiresAt)) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, "id = ?", key.UserID).Error; err != nil {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	if key.LastUsedAt == nil || time.Since(*key.LastUsedAt) > time.Minute {
+		now := time.Now()
+		key.LastUsedAt = &now
+		database.DB.Model(&models.APIKey{}).Where("id = ?", key.ID).Update("last_used_at", now)
+	}
+
+	return &key, &user, nil
+}
+
+// KeyAllows reports whether the key was granted the scope.
+func KeyAllows(key *models.APIKey, perm Permission) bool {
+	for _, scope := range key.Scopes {
+		if Permission(scope) == perm {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"log"
+	"os"
+	"review-products/database"
+	"review-products/models"
+	"time"
+)
+
+// BootstrapAdmin makes sure there is at least one admin. When no admin
+// exists yet, the user with ADMIN_EMAIL is promoted, or created with
+// ADMIN_PASSWORD if it does not exist. The password goes through the same
+// policy and bcrypt cost as registration.
+func BootstrapAdmin() {
+	email := os.Getenv("ADMIN_EMAIL")
+	if email == "" {
+		return
+	}
+
+	var admins int64
+	if err := database.DB.Model(&models.User{}).Where("role = ?", models.RoleAdmin).Count(&admins).Error; err != nil {
+		log.Fatalf("❌ Admin bootstrap failed: %v", err)
+	}
+	if admins > 0 {
+		return
+	}
+
+	var user models.User
+	if err := database.DB.Where("email = ?", email).First(&user).Error; err == nil {
+		if err := database.DB.Model(&user).Update("role", models.RoleAdmin).Error; err != nil {
+			log.Fatalf("❌ Admin bootstrap failed: %v", err)
+		}
+		log.Printf("✅ Promoted %s to admin", email)
+		return
+	}
+
+	password := os.Getenv("ADMIN_PASSWORD")
+	if password == "" {
+		log.Printf("⚠️ ADMIN_EMAIL %s not found and ADMIN_PASSWORD is empty, skipping admin bootstrap", email)
+		return
+	}
+
+	if err := ValidatePassword(password, email); err != nil {
+		log.Fatalf("❌ Admin bootstrap failed: ADMIN_PASSWORD rejected: %v", err)
+	}
+	hashedPassword, err := HashPassword(password)
+	if err != nil {
+		log.Fatalf("❌ Admin bootstrap failed: %v", err)
+	}
+
+	now := time.Now()
+	user = models.User{
+		Email:           email,
+		Password:        hashedPassword,
+		Role:            models.RoleAdmin,
+		EmailVerifiedAt: &now,
+	}
+	if err := database.DB.Create(&user).Error; err != nil {
+		log.Fatalf("❌ Admin bootstrap failed: %v", err)
+	}
+	log.Printf("✅ Created admin %s", email)
+}
@@ -0,0 +1,436 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+const (
+	// createdHeader is the PEM header holding a key's creation time. File
+	// times change whenever keys are copied or restored, so they are only
+	// used for files written before the header existed.
+	createdHeader = "Created"
+
+	rotationLockFile = ".rotation.lock"
+	// rotationLockStale is when a lock is assumed to be left behind by a
+	// crashed instance and broken.
+	rotationLockStale = time.Minute
+)
+
+type signingKey struct {
+	ID        string
+	Alg       string
+	Private   crypto.Signer
+	CreatedAt time.Time
+	// legacy keys have no Created header yet.
+	legacy bool
+}
+
+// Keyring holds the asymmetric keys used to sign and verify tokens. Keys
+// are PKCS#8 PEM files named <kid>.pem in a directory, so every instance
+// sharing the directory signs with the same active key and can verify
+// tokens signed by the others. Rotation holds a lock file in the directory
+// so only one instance generates or removes keys at a time.
+type Keyring struct {
+	mu         sync.RWMutex
+	dir        string
+	alg        string
+	rotateEach time.Duration
+	retention  time.Duration
+	keys       map[string]*signingKey
+	active     *signingKey
+	lastReload time.Time
+}
+
+var (
+	keyringMu sync.RWMutex
+	keyring   *Keyring
+)
+
+// InitKeyring loads (or creates) the signing keys and starts scheduled
+// rotation. It must be called before tokens are issued or verified.
+//
+//	JWT_KEYS_DIR       directory holding <kid>.pem files (default "keys")
+//	JWT_SIGNING_ALG    RS256 or EdDSA for newly generated keys (default RS256)
+//	JWT_KEY_ROTATION   how long a key stays active (default 720h)
+//	JWT_KEY_RETENTION  how long a retired key still verifies (default 48h)
+func InitKeyring() {
+	dir := os.Getenv("JWT_KEYS_DIR")
+	if dir == "" {
+		dir = "keys"
+	}
+
+	alg := os.Getenv("JWT_SIGNING_ALG")
+	if alg == "" {
+		alg = AlgRS256
+	}
+	if alg != AlgRS256 && alg != AlgEdDSA {
+		log.Fatalf("❌ Unsupported JWT_SIGNING_ALG %q", alg)
+	}
+
+	kr := &Keyring{
+		dir:        dir,
+		alg:        alg,
+		rotateEach: DurationEnv("JWT_KEY_ROTATION", 30*24*time.Hour),
+		retention:  DurationEnv("JWT_KEY_RETENTION", 48*time.Hour),
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		log.Fatalf("❌ Failed to create key directory: %v", err)
+	}
+	if err := kr.rotateIfDue(); err != nil {
+		log.Fatalf("❌ Failed to load signing keys: %v", err)
+	}
+
+	keyringMu.Lock()
+	keyring = kr
+	keyringMu.Unlock()
+
+	go kr.runRotation()
+	log.Printf("✅ Signing keys loaded, active kid %s", kr.active.ID)
+}
+
+func currentKeyring() (*Keyring, error) {
+	keyringMu.RLock()
+	defer keyringMu.RUnlock()
+
+	if keyring == nil {
+		return nil, errors.New("signing keyring is not initialized")
+	}
+	return keyring, nil
+}
+
+func (kr *Keyring) runRotation() {
+	interval := time.Hour
+	if kr.rotateEach < interval {
+		interval = kr.rotateEach
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := kr.rotateIfDue(); err != nil {
+			log.Printf("⚠️ Signing key rotation failed: %v", err)
+		}
+	}
+}
+
+// rotateIfDue reloads the key directory, generates a new active key when
+// the newest one is older than the rotation period, and drops retired keys
+// past their retention window. The directory is re-read after taking the
+// rotation lock, so an instance that waited sees the key another one just
+// generated instead of generating its own.
+func (kr *Keyring) rotateIfDue() error {
+	unlock, err := kr.lockRotation()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+
+	if err := kr.load(); err != nil {
+		return err
+	}
+	kr.stampLegacy()
+
+	if kr.active == nil || time.Since(kr.active.CreatedAt) >= kr.rotateEach {
+		key, err := kr.generate()
+		if err != nil {
+			return err
+		}
+		kr.keys[key.ID] = key
+		kr.active = key
+		log.Printf("🔑 Rotated signing key, active kid %s", key.ID)
+	}
+
+	kr.prune()
+	return nil
+}
+
+// lockRotation takes the rotation lock shared by every instance using the
+// key directory, waiting up to rotationLockStale for another holder.
+func (kr *Keyring) lockRotation() (unlock func(), err error) {
+	path := filepath.Join(kr.dir, rotationLockFile)
+	deadline := time.Now().Add(rotationLockStale)
+
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > rotationLockStale {
+			log.Printf("⚠️ Breaking stale signing key rotation lock")
+			os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, errors.New("timed out waiting for the signing key rotation lock")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// stampLegacy writes the Created header into key files that predate it,
+// pinning the creation time taken from the file's modification time.
+func (kr *Keyring) stampLegacy() {
+	for _, key := range kr.keys {
+		if !key.legacy {
+			continue
+		}
+		if err := writeKeyFile(kr.dir, key); err != nil {
+			log.Printf("⚠️ Failed to record creation time of key %s: %v", key.ID, err)
+			continue
+		}
+		key.legacy = false
+	}
+}
+
+func (kr *Keyring) load() error {
+	files, err := filepath.Glob(filepath.Join(kr.dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]*signingKey, len(files))
+	var active *signingKey
+	for _, file := range files {
+		key, err := readKeyFile(file)
+		if errors.Is(err, os.ErrNotExist) {
+			// pruned by another instance since the Glob
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		keys[key.ID] = key
+		if active == nil || key.CreatedAt.After(active.CreatedAt) {
+			active = key
+		}
+	}
+
+	kr.keys = keys
+	kr.active = active
+	kr.lastReload = time.Now()
+	return nil
+}
+
+func readKeyFile(file string) (*signingKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &signingKey{ID: strings.TrimSuffix(filepath.Base(file), ".pem")}
+	if created, ok := block.Headers[createdHeader]; ok {
+		if key.CreatedAt, err = time.Parse(time.RFC3339, created); err != nil {
+			return nil, fmt.Errorf("invalid %s header: %w", createdHeader, err)
+		}
+	} else {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		key.CreatedAt, key.legacy = info.ModTime(), true
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Alg, key.Private = AlgRS256, k
+	case ed25519.PrivateKey:
+		key.Alg, key.Private = AlgEdDSA, k
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+
+	return key, nil
+}
+
+func (kr *Keyring) generate() (*signingKey, error) {
+	key := &signingKey{
+		ID:        uuid.NewString(),
+		Alg:       kr.alg,
+		CreatedAt: time.Now(),
+	}
+
+	var err error
+	switch kr.alg {
+	case AlgEdDSA:
+		_, key.Private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		key.Private, err = rsa.GenerateKey(rand.Reader, 2048)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeKeyFile(kr.dir, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// writeKeyFile writes key with its creation time. The file is renamed into
+// place, so other instances never read it half written.
+func writeKeyFile(dir string, key *signingKey) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key.Private)
+	if err != nil {
+		return err
+	}
+
+	data := pem.EncodeToMemory(&pem.Block{
+		Type:    "PRIVATE KEY",
+		Headers: map[string]string{createdHeader: key.CreatedAt.UTC().Format(time.RFC3339)},
+		Bytes:   der,
+	})
+
+	path := filepath.Join(dir, key.ID+".pem")
+	if err := os.WriteFile(path+".tmp", data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// prune removes keys whose successor has been active for longer than the
+// retention window; tokens they signed have expired by then.
+func (kr *Keyring) prune() {
+	sorted := make([]*signingKey, 0, len(kr.keys))
+	for _, key := range kr.keys {
+		sorted = append(sorted, key)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].CreatedAt.After(sorted[j].CreatedAt) })
+
+	for i := 1; i < len(sorted); i++ {
+		successor := sorted[i-1]
+		if time.Since(successor.CreatedAt) < kr.retention {
+			continue
+		}
+
+		key := sorted[i]
+		delete(kr.keys, key.ID)
+		if err := os.Remove(filepath.Join(kr.dir, key.ID+".pem")); err != nil && !os.IsNotExist(err) {
+			log.Printf("⚠️ Failed to remove retired key %s: %v", key.ID, err)
+		}
+	}
+}
+
+func (kr *Keyring) sign(claims jwt.Claims) (string, error) {
+	kr.mu.RLock()
+	key := kr.active
+	kr.mu.RUnlock()
+
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Alg), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Private)
+}
+
+// keyFunc resolves the verification key from the token's kid. An unknown
+// kid triggers one reload so keys rotated by another instance are found.
+func (kr *Keyring) keyFunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	if kid == "" {
+		return nil, errors.New("missing kid header")
+	}
+
+	kr.mu.RLock()
+	key, ok := kr.keys[kid]
+	stale := time.Since(kr.lastReload) > time.Minute
+	kr.mu.RUnlock()
+
+	if !ok && stale {
+		kr.mu.Lock()
+		if err := kr.load(); err != nil {
+			log.Printf("⚠️ Failed to reload signing keys: %v", err)
+		}
+		key, ok = kr.keys[kid]
+		kr.mu.Unlock()
+	}
+
+	if !ok {
+		return nil, errors.New("unknown kid")
+	}
+	if t.Method.Alg() != key.Alg {
+		return nil, errors.New("alg does not match key")
+	}
+
+	return key.Private.Public(), nil
+}
+
+// JWKS returns the public half of every key that can still verify tokens.
+func (kr *Keyring) JWKS() map[string]interface{} {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	keys := make([]map[string]string, 0, len(kr.keys))
+	for _, key := range kr.keys {
+		jwk := map[string]string{
+			"kid": key.ID,
+			"alg": key.Alg,
+			"use": "sig",
+		}
+
+		switch pub := key.Private.Public().(type) {
+		case *rsa.PublicKey:
+			jwk["kty"] = "RSA"
+			jwk["n"] = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk["e"] = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk["kty"] = "OKP"
+			jwk["crv"] = "Ed25519"
+			jwk["x"] = base64.RawURLEncoding.EncodeToString(pub)
+		}
+
+		keys = append(keys, jwk)
+	}
+
+	return map[string]interface{}{"keys": keys}
+}
+
+// JWKS returns the public key set of the initialized keyring.
+func JWKS() (map[string]interface{}, error) {
+	kr, err := currentKeyring()
+	if err != nil {
+		return nil, err
+	}
+	return kr.JWKS(), nil
+}
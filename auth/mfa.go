@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"crypto/rand"
+	"errors"
+	"strings"
+	"time"
+
+	"review-products/database"
+	"review-products/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	TokenUseMFAChallenge = "mfa_challenge"
+	recoveryCodeCount    = 10
+)
+
+var ErrInvalidMFACode = errors.New("invalid MFA code")
+
+// MFAChallengeTTL is read from MFA_CHALLENGE_TTL, default 5 minutes.
+func MFAChallengeTTL() time.Duration {
+	return DurationEnv("MFA_CHALLENGE_TTL", 5*time.Minute)
+}
+
+// NewMFAChallengeToken is returned by login after the password check when
+// the user has TOTP enabled. It only proves the first factor.
+func NewMFAChallengeToken(userID uuid.UUID, email string) (string, error) {
+	return signClaims(newClaims(userID, email, TokenUseMFAChallenge, MFAChallengeTTL()))
+}
+
+func ParseMFAChallengeToken(tokenString string) (*Claims, error) {
+	return parseClaims(tokenString, TokenUseMFAChallenge)
+}
+
+// VerifyTOTP validates code against the user's secret and records the
+// matched step, so the same code cannot be used twice.
+func VerifyTOTP(user *models.User, code string) error {
+	if user.TOTPSecret == nil {
+		return ErrInvalidMFACode
+	}
+
+	step, ok := ValidateTOTP(*user.TOTPSecret, code, user.TOTPLastStep)
+	if !ok {
+		return ErrInvalidMFACode
+	}
+
+	result := database.DB.Model(&models.User{}).
+		Where("id = ? AND totp_last_step < ?", user.ID, step).
+		Update("totp_last_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidMFACode
+	}
+
+	user.TOTPLastStep = step
+	return nil
+}
+
+// UseRecoveryCode consumes one of the user's recovery codes.
+func UseRecoveryCode(userID uuid.UUID, code string) error {
+	result := database.DB.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, HashToken(normalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// ReplaceRecoveryCodes deletes the user's old recovery codes and returns a
+// fresh set. The plain codes are only ever shown in this response.
+func ReplaceRecoveryCodes(tx *gorm.DB, userID uuid.UUID) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	rows := make([]models.RecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		rows[i] = models.RecoveryCode{
+			UserID:   userID,
+			CodeHash: HashToken(normalizeRecoveryCode(code)),
+		}
+	}
+
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// newRecoveryCode returns a code like "k3m9-x7qp-2hwa".
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	s := strings.ToLower(base32NoPad.EncodeToString(b))[:12]
+	return s[0:4] + "-" + s[4:8] + "-" + s[8:12], nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+//go:embed common_passwords.txt
+var commonPasswordsFile string
+
+var (
+	commonPasswordsOnce sync.Once
+	commonPasswords     map[string]bool
+)
+
+// bcrypt ignores anything past 72 bytes, so longer passwords are rejected
+// rather than silently truncated.
+const maxPasswordBytes = 72
+
+// PasswordPolicy is read from the environment:
+//
+//	PASSWORD_MIN_LENGTH      minimum length in characters (default 8)
+//	PASSWORD_REQUIRE_UPPER   "true" to require an upper-case letter
+//	PASSWORD_REQUIRE_LOWER   "true" to require a lower-case letter
+//	PASSWORD_REQUIRE_DIGIT   "true" to require a digit
+//	PASSWORD_REQUIRE_SYMBOL  "true" to require a symbol or punctuation
+type PasswordPolicy struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+}
+
+func CurrentPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:     intEnv("PASSWORD_MIN_LENGTH", 8),
+		RequireUpper:  os.Getenv("PASSWORD_REQUIRE_UPPER") == "true",
+		RequireLower:  os.Getenv("PASSWORD_REQUIRE_LOWER") == "true",
+		RequireDigit:  os.Getenv("PASSWORD_REQUIRE_DIGIT") == "true",
+		RequireSymbol: os.Getenv("PASSWORD_REQUIRE_SYMBOL") == "true",
+	}
+}
+
+// ValidatePassword checks password against the current policy. The error
+// message lists every rule that failed and is safe to show to the user.
+func ValidatePassword(password, email string) error {
+	policy := CurrentPasswordPolicy()
+	var problems []string
+
+	if len([]rune(password)) < policy.MinLength {
+		problems = append(problems, "be at least "+strconv.Itoa(policy.MinLength)+" characters long")
+	}
+	if len(password) > maxPasswordBytes {
+		problems = append(problems, "be at most "+strconv.Itoa(maxPasswordBytes)+" bytes long")
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			hasSymbol = true
+		}
+	}
+
+	if policy.RequireUpper && !hasUpper {
+		problems = append(problems, "contain an upper-case letter")
+	}
+	if policy.RequireLower && !hasLower {
+		problems = append(problems, "contain a lower-case letter")
+	}
+	if policy.RequireDigit && !hasDigit {
+		problems = append(problems, "contain a digit")
+	}
+	if policy.RequireSymbol && !hasSymbol {
+		problems = append(problems, "contain a symbol")
+	}
+
+	lowered := strings.ToLower(password)
+	localPart, _, _ := strings.Cut(strings.ToLower(email), "@")
+	if email != "" && (lowered == strings.ToLower(email) || lowered == localPart) {
+		problems = append(problems, "not be the same as your email")
+	}
+
+	if isCommonPassword(lowered) {
+		problems = append(problems, "not be a commonly used password")
+	}
+
+	if len(problems) > 0 {
+		return errors.New("Password must " + strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+func isCommonPassword(lowered string) bool {
+	commonPasswordsOnce.Do(func() {
+		commonPasswords = make(map[string]bool)
+		scanner := bufio.NewScanner(strings.NewReader(commonPasswordsFile))
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				commonPasswords[strings.ToLower(line)] = true
+			}
+		}
+	})
+	return commonPasswords[lowered]
+}
+
+// BcryptCost is read from BCRYPT_COST, default 12. Raising it makes
+// existing hashes get upgraded on the next successful login.
+func BcryptCost() int {
+	cost := intEnv("BCRYPT_COST", 12)
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return 12
+	}
+	return cost
+}
+
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), BcryptCost())
+	return string(hash), err
+}
+
+// NeedsRehash reports whether hash was created with a lower cost than the
+// configured one.
+func NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err == nil && cost < BcryptCost()
+}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+
+	"review-products/models"
+)
+
+type Permission string
+
+const (
+	PermProductWrite    Permission = "product:write"
+	PermReviewWrite     Permission = "review:write"
+	PermReviewUpdateAny Permission = "review:update:any"
+	PermReviewDeleteAny Permission = "review:delete:any"
+	PermUserManage      Permission = "user:manage"
+	PermCategoryManage  Permission = "category:manage"
+)
+
+// defaultMatrix is used unless RBAC_POLICY_FILE points to a JSON file
+// of the same shape, e.g. {"moderator": ["review:write", "review:delete:any"]}.
+var defaultMatrix = map[string][]Permission{
+	models.RoleUser: {
+		PermReviewWrite,
+	},
+	models.RoleModerator: {
+		PermReviewWrite,
+		PermReviewUpdateAny,
+		PermReviewDeleteAny,
+	},
+	models.RoleAdmin: {
+		PermProductWrite,
+		PermReviewWrite,
+		PermReviewUpdateAny,
+		PermReviewDeleteAny,
+		PermUserManage,
+		PermCategoryManage,
+	},
+}
+
+var (
+	matrixOnce sync.Once
+	matrix     map[string]map[Permission]bool
+)
+
+func loadMatrix() {
+	source := defaultMatrix
+
+	if path := os.Getenv("RBAC_POLICY_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatalf("Failed to read RBAC policy: %v", err)
+		}
+
+		var custom map[string][]Permission
+		if err := json.Unmarshal(data, &custom); err != nil {
+			log.Fatalf("Failed to parse RBAC policy: %v", err)
+		}
+		source = custom
+	}
+
+	matrix = make(map[string]map[Permission]bool, len(source))
+	for role, perms := range source {
+		matrix[role] = make(map[Permission]bool, len(perms))
+		for _, perm := range perms {
+			matrix[role][perm] = true
+		}
+	}
+}
+
+// Can reports whether the role is granted the permission.
+func Can(role string, perm Permission) bool {
+	matrixOnce.Do(loadMatrix)
+	return matrix[role][perm]
+}
+
+// ValidRole reports whether the role exists in the permission matrix.
+func ValidRole(role string) bool {
+	matrixOnce.Do(loadMatrix)
+	_, ok := matrix[role]
+	return ok
+}
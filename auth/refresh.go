@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"review-products/database"
+	"review-products/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+)
+
+// RefreshTokenTTL is read from REFRESH_TOKEN_TTL (e.g. "720h"), default 30 days.
+func RefreshTokenTTL() time.Duration {
+	return DurationEnv("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+}
+
+// HashToken is used for every opaque token we persist; only the hash is stored.
+func HashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// RandomToken returns n random bytes encoded as URL-safe base64.
+func RandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// IssueRefreshToken starts a new token family for the user and returns the
+// raw token. The raw value is never stored.
+func IssueRefreshToken(userID uuid.UUID, userAgent, ip string) (string, error) {
+	raw, _, err := createRefreshToken(database.DB, userID, uuid.New(), userAgent, ip)
+	return raw, err
+}
+
+func createRefreshToken(tx *gorm.DB, userID, familyID uuid.UUID, userAgent, ip string) (string, *models.RefreshToken, error) {
+	raw, err := RandomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+
+	token := models.RefreshToken{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: HashToken(raw),
+		ExpiresAt: time.Now().Add(RefreshTokenTTL()),
+		UserAgent: userAgent,
+		IP:        ip,
+	}
+	if err := tx.Create(&token).Error; err != nil {
+		return "", nil, err
+	}
+
+	return raw, &token, nil
+}
+
+// RotateRefreshToken consumes raw and returns its owner plus a replacement
+// token in the same family. Presenting an already used token revokes the
+// whole family and returns ErrRefreshTokenReused.
+func RotateRefreshToken(raw, userAgent, ip string) (*models.User, string, error) {
+	var current models.RefreshToken
+	if err := database.DB.Where("token_hash = ?", HashToken(raw)).First(&current).Error; err != nil {
+		return nil, "", ErrInvalidRefreshToken
+	}
+
+	if current.RevokedAt != nil {
+		if err := revokeFamily(database.DB, current.FamilyID); err != nil {
+			return nil, "", err
+		}
+		return nil, "", ErrRefreshTokenReused
+	}
+
+	if time.Now().After(current.ExpiresAt) {
+		return nil, "", ErrInvalidRefreshToken
+	}
+
+	var user models.User
+	var newRaw string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&user, "id = ?", current.UserID).Error; err != nil {
+			return ErrInvalidRefreshToken
+		}
+
+		// ใช้ได้ครั้งเดียว: ถ้ามี request อื่น rotate ไปก่อน ให้ถือว่าเป็นการ reuse
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND revoked_at IS NULL", current.ID).
+			Update("revoked_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRefreshTokenReused
+		}
+
+		var next *models.RefreshToken
+		var err error
+		newRaw, next, err = createRefreshToken(tx, current.UserID, current.FamilyID, userAgent, ip)
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&models.RefreshToken{}).
+			Where("id = ?", current.ID).
+			Update("replaced_by_id", next.ID).Error
+	})
+	if errors.Is(err, ErrRefreshTokenReused) {
+		if err := revokeFamily(database.DB, current.FamilyID); err != nil {
+			return nil, "", err
+		}
+		return nil, "", ErrRefreshTokenReused
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &user, newRaw, nil
+}
+
+// RevokeRefreshToken ends the session raw belongs to. Unknown tokens are ignored.
+func RevokeRefreshToken(raw string) error {
+	var token models.RefreshToken
+	if err := database.DB.Where("token_hash = ?", HashToken(raw)).First(&token).Error; err != nil {
+		return nil
+	}
+	return revokeFamily(database.DB, token.FamilyID)
+}
+
+// RevokeAllSessions revokes every refresh token of the user and bumps
+// SessionVersion so outstanding access tokens stop working too.
+func RevokeAllSessions(userID uuid.UUID) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&models.User{}).
+			Where("id = ?", userID).
+			Update("session_version", gorm.Expr("session_version + 1")).Error
+	})
+}
+
+func revokeFamily(tx *gorm.DB, familyID uuid.UUID) error {
+	return tx.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"review-products/database"
+	"review-products/models"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidResetToken = errors.New("invalid or expired reset token")
+
+// PasswordResetTTL is read from PASSWORD_RESET_TTL, default 1 hour.
+func PasswordResetTTL() time.Duration {
+	return DurationEnv("PASSWORD_RESET_TTL", time.Hour)
+}
+
+// CreatePasswordResetToken invalidates any outstanding reset token of the
+// user and returns a new raw token. Only its hash is stored.
+func CreatePasswordResetToken(userID uuid.UUID) (string, error) {
+	raw, err := RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	if err := database.DB.Model(&models.PasswordResetToken{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("used_at", time.Now()).Error; err != nil {
+		return "", err
+	}
+
+	token := models.PasswordResetToken{
+		UserID:    userID,
+		TokenHash: HashToken(raw),
+		ExpiresAt: time.Now().Add(PasswordResetTTL()),
+	}
+	if err := database.DB.Create(&token).Error; err != nil {
+		return "", err
+	}
+
+	return raw, nil
+}
+
+// PasswordResetUser returns the owner of a valid, unused reset token
+// without consuming it, so the new password can be checked first.
+func PasswordResetUser(raw string) (*models.User, error) {
+	var token models.PasswordResetToken
+	if err := database.DB.
+		Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", HashToken(raw), time.Now()).
+		First(&token).Error; err != nil {
+		return nil, ErrInvalidResetToken
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, "id = ?", token.UserID).Error; err != nil {
+		return nil, ErrInvalidResetToken
+	}
+
+	return &user, nil
+}
+
+// ConsumePasswordResetToken marks raw as used and returns its user ID.
+// A token can only be consumed once.
+func ConsumePasswordResetToken(raw string) (uuid.UUID, error) {
+	var token models.PasswordResetToken
+	if err := database.DB.Where("token_hash = ?", HashToken(raw)).First(&token).Error; err != nil {
+		return uuid.Nil, ErrInvalidResetToken
+	}
+
+	result := database.DB.Model(&models.PasswordResetToken{}).
+		Where("id = ? AND used_at IS NULL AND expires_at > ?", token.ID, time.Now()).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return uuid.Nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return uuid.Nil, ErrInvalidResetToken
+	}
+
+	return token.UserID, nil
+}
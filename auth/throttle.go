@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"review-products/database"
+	"review-products/models"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Failed logins are counted per email (known or not, so lockouts do not
+// reveal which accounts exist) and per client IP. Once a key reaches its
+// threshold it is locked for LOGIN_LOCKOUT_BASE, doubling with every
+// further failure up to LOGIN_LOCKOUT_MAX. Counters reset after
+// LOGIN_FAILURE_WINDOW without failures.
+func accountKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+func intEnv(key string, fallback int) int {
+	if n, err := strconv.Atoi(os.Getenv(key)); err == nil && n > 0 {
+		return n
+	}
+	return fallback
+}
+
+// LoginRetryAfter returns how long the email or IP is still locked, or 0.
+func LoginRetryAfter(email, ip string) (time.Duration, error) {
+	var throttles []models.LoginThrottle
+	if err := database.DB.
+		Where("key IN ?", []string{accountKey(email), ipKey(ip)}).
+		Find(&throttles).Error; err != nil {
+		return 0, err
+	}
+
+	var wait time.Duration
+	for _, t := range throttles {
+		if t.LockedUntil != nil {
+			if d := time.Until(*t.LockedUntil); d > wait {
+				wait = d
+			}
+		}
+	}
+	return wait, nil
+}
+
+// RecordLoginFailure bumps the counters for the email and the IP and locks
+// whichever crossed its threshold.
+func RecordLoginFailure(email, ip string) error {
+	if err := recordFailure(accountKey(email), intEnv("LOGIN_MAX_ACCOUNT_FAILURES", 5)); err != nil {
+		return err
+	}
+	return recordFailure(ipKey(ip), intEnv("LOGIN_MAX_IP_FAILURES", 20))
+}
+
+func recordFailure(key string, threshold int) error {
+	now := time.Now()
+	windowStart := now.Add(-DurationEnv("LOGIN_FAILURE_WINDOW", time.Hour))
+
+	// upsert แบบ atomic เพื่อไม่ให้ request พร้อมกันนับพลาด
+	var failures int
+	if err := database.DB.Raw(`
+		INSERT INTO login_throttles (key, failures, last_failure_at, updated_at)
+		VALUES (?, 1, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN login_throttles.last_failure_at < ? THEN 1 ELSE login_throttles.failures + 1 END,
+			last_failure_at = EXCLUDED.last_failure_at,
+			updated_at = EXCLUDED.updated_at
+		RETURNING failures`, key, now, now, windowStart).Scan(&failures).Error; err != nil {
+		return err
+	}
+
+	if failures < threshold {
+		return nil
+	}
+
+	base := DurationEnv("LOGIN_LOCKOUT_BASE", 30*time.Second)
+	max := DurationEnv("LOGIN_LOCKOUT_MAX", time.Hour)
+
+	lockout := time.Duration(float64(base) * math.Pow(2, float64(failures-threshold)))
+	if lockout > max || lockout <= 0 {
+		lockout = max
+	}
+
+	return database.DB.Model(&models.LoginThrottle{}).
+		Where("key = ?", key).
+		Update("locked_until", now.Add(lockout)).Error
+}
+
+// ResetLoginFailures clears the email counter after a successful login.
+// The IP counter is left alone so one valid account cannot reset it.
+func ResetLoginFailures(email string) error {
+	return database.DB.Where("key = ?", accountKey(email)).Delete(&models.LoginThrottle{}).Error
+}
+
+// UnlockAccount is the admin override for a locked email.
+func UnlockAccount(email string) error {
+	return ResetLoginFailures(email)
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     []byte
+)
+
+// SimulatePasswordCheck spends the same bcrypt work as a real comparison,
+// so unknown emails take as long to reject as wrong passwords.
+func SimulatePasswordCheck(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not-a-real-password"), BcryptCost())
+	})
+	_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+}
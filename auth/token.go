@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	TokenUseAccess            = "access"
+	TokenUseEmailVerification = "email_verification"
+)
+
+// Claims is the payload carried by tokens issued from LoginHandler.
+type Claims struct {
+	UserID         string `json:"userId"`
+	Email          string `json:"email"`
+	TokenUse       string `json:"token_use"`
+	SessionVersion int    `json:"sv"`
+	jwt.RegisteredClaims
+}
+
+func issuer() string {
+	if v := os.Getenv("JWT_ISSUER"); v != "" {
+		return v
+	}
+	return "review-products"
+}
+
+func audience() string {
+	if v := os.Getenv("JWT_AUDIENCE"); v != "" {
+		return v
+	}
+	return "review-products-api"
+}
+
+// AccessTokenTTL is read from ACCESS_TOKEN_TTL (e.g. "15m"), default 15 minutes.
+func AccessTokenTTL() time.Duration {
+	return DurationEnv("ACCESS_TOKEN_TTL", 15*time.Minute)
+}
+
+// DurationEnv parses the env variable key as a time.Duration ("90s",
+// "24h"), returning fallback when it is unset, invalid or not positive.
+func DurationEnv(key string, fallback time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil && d > 0 {
+		return d
+	}
+	return fallback
+}
+
+// NewAccessToken signs a short-lived access token for the given user with
+// the active key of the keyring.
+func NewAccessToken(userID uuid.UUID, email string, sessionVersion int) (string, error) {
+	claims := newClaims(userID, email, TokenUseAccess, AccessTokenTTL())
+	claims.SessionVersion = sessionVersion
+	return signClaims(claims)
+}
+
+// EmailVerificationTTL is read from EMAIL_VERIFICATION_TTL, default 24 hours.
+func EmailVerificationTTL() time.Duration {
+	return DurationEnv("EMAIL_VERIFICATION_TTL", 24*time.Hour)
+}
+
+// NewEmailVerificationToken signs the token embedded in verification links.
+// It carries the email so the link stops working if the email changes.
+func NewEmailVerificationToken(userID uuid.UUID, email string) (string, error) {
+	return signClaims(newClaims(userID, email, TokenUseEmailVerification, EmailVerificationTTL()))
+}
+
+// ParseToken verifies signature, expiry, issuer and audience of an access
+// token and returns the claims.
+func ParseToken(tokenString string) (*Claims, error) {
+	return parseClaims(tokenString, TokenUseAccess)
+}
+
+// ParseEmailVerificationToken verifies a token from a verification link.
+func ParseEmailVerificationToken(tokenString string) (*Claims, error) {
+	return parseClaims(tokenString, TokenUseEmailVerification)
+}
+
+func newClaims(userID uuid.UUID, email, use string, ttl time.Duration) Claims {
+	now := time.Now()
+	return Claims{
+		UserID:   userID.String(),
+		Email:    email,
+		TokenUse: use,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Subject:   userID.String(),
+			Issuer:    issuer(),
+			Audience:  jwt.ClaimStrings{audience()},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+}
+
+func signClaims(claims Claims) (string, error) {
+	kr, err := currentKeyring()
+	if err != nil {
+		return "", err
+	}
+	return kr.sign(claims)
+}
+
+// parseClaims rejects tokens minted for a different purpose, so e.g. a
+// verification link cannot be used as a bearer token.
+func parseClaims(tokenString, use string) (*Claims, error) {
+	kr, err := currentKeyring()
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &Claims{}
+	_, err = jwt.ParseWithClaims(tokenString, claims, kr.keyFunc,
+		jwt.WithValidMethods([]string{AlgRS256, AlgEdDSA}),
+		jwt.WithIssuer(issuer()),
+		jwt.WithAudience(audience()),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.TokenUse != use {
+		return nil, errors.New("unexpected token use")
+	}
+
+	if _, err := uuid.Parse(claims.UserID); err != nil {
+		return nil, errors.New("invalid userId claim")
+	}
+
+	return claims, nil
+}
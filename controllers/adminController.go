@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"errors"
+	"review-products/auth"
+	"review-products/database"
+	"review-products/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errLastAdmin = errors.New("cannot demote the last admin")
+
+func UpdateUserRole(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Invalid user ID format",
+		})
+	}
+
+	type Input struct {
+		Role string `json:"role"`
+	}
+
+	var input Input
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Invalid JSON body",
+		})
+	}
+
+	if !auth.ValidRole(input.Role) {
+		return c.Status(400).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Unknown role",
+		})
+	}
+
+	var user models.User
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// ล็อกแถว admin ทั้งหมดก่อน การลด role พร้อมกันสองคนจะได้ไม่เหลือ admin เป็นศูนย์
+		var admins []uuid.UUID
+		if err := tx.Model(&models.User{}).
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("role = ?", models.RoleAdmin).
+			Pluck("id", &admins).Error; err != nil {
+			return err
+		}
+
+		if err := tx.First(&user, "id = ?", uid).Error; err != nil {
+			return err
+		}
+		if user.Role == models.RoleAdmin && input.Role != models.RoleAdmin && len(admins) <= 1 {
+			return errLastAdmin
+		}
+
+		user.Role = input.Role
+		return tx.Model(&user).Update("role", user.Role).Error
+	})
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.Status(404).JSON(fiber.Map{
+			"ok":    false,
+			"error": "User not found",
+		})
+	case errors.Is(err, errLastAdmin):
+		return c.Status(409).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Cannot demote the last admin",
+		})
+	case err != nil:
+		return c.Status(500).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Failed to update role",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"ok":      true,
+		"message": "Role updated successfully",
+		"user":    user,
+	})
+}
+
+func UnlockUser(c *fiber.Ctx) error {
+	uid, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Invalid user ID format",
+		})
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, "id = ?", uid).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"ok":    false,
+			"error": "User not found",
+		})
+	}
+
+	if err := auth.UnlockAccount(user.Email); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Failed to unlock user",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"ok":      true,
+		"message": "User unlocked successfully",
+	})
+}
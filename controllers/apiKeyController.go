@@ -0,0 +1,161 @@
+package controllers
+
+import (
+	"review-products/auth"
+	"review-products/database"
+	"review-products/middleware"
+	"review-products/models"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+func CreateAPIKey(c *fiber.Ctx) error {
+	user := middleware.CurrentUser(c)
+
+	type Input struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+
+	var input Input
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Invalid JSON body",
+		})
+	}
+
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Name is required",
+		})
+	}
+
+	if err := auth.ValidateScopes(user.Role, input.Scopes); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"ok":    false,
+			"error": err.Error(),
+		})
+	}
+
+	if input.ExpiresInDays < 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"ok":    false,
+			"error": "expires_in_days must not be negative",
+		})
+	}
+
+	raw, prefix, hash, err := auth.GenerateAPIKey()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Failed to generate API key",
+		})
+	}
+
+	apiKey := models.APIKey{
+		UserID:  user.ID,
+		Name:    input.Name,
+		Prefix:  prefix,
+		KeyHash: hash,
+		Scopes:  input.Scopes,
+	}
+	if input.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, input.ExpiresInDays)
+		apiKey.ExpiresAt = &expiresAt
+	}
+
+	if err := database.DB.Create(&apiKey).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Failed to create API key",
+		})
+	}
+
+	// key เต็มแสดงครั้งเดียวตอนสร้างเท่านั้น
+	return c.JSON(fiber.Map{
+		"ok":      true,
+		"message": "Store this key now, it will not be shown again",
+		"key":     raw,
+		"api_key": apiKey,
+	})
+}
+
+// ListAPIKeys returns the caller's keys. Users who can manage users may
+// pass ?user_id= to list someone else's.
+func ListAPIKeys(c *fiber.Ctx) error {
+	user := middleware.CurrentUser(c)
+	ownerID := user.ID
+
+	if id := c.Query("user_id"); id != "" {
+		if !middleware.HasPermission(c, auth.PermUserManage) {
+			return middleware.Forbidden(c, "You can only list your own API keys")
+		}
+
+		uid, err := uuid.Parse(id)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"ok":    false,
+				"error": "Invalid user ID format",
+			})
+		}
+		ownerID = uid
+	}
+
+	var keys []models.APIKey
+	if err := database.DB.Where("user_id = ?", ownerID).Order("created_at DESC").Find(&keys).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Failed to fetch API keys",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"ok":       true,
+		"api_keys": keys,
+		"count":    len(keys),
+	})
+}
+
+func RevokeAPIKey(c *fiber.Ctx) error {
+	uid, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Invalid API key ID format",
+		})
+	}
+
+	var apiKey models.APIKey
+	if err := database.DB.First(&apiKey, "id = ?", uid).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"ok":    false,
+			"error": "API key not found",
+		})
+	}
+
+	user := middleware.CurrentUser(c)
+	if apiKey.UserID != user.ID && !middleware.HasPermission(c, auth.PermUserManage) {
+		return middleware.Forbidden(c, "You can only revoke your own API keys")
+	}
+
+	if apiKey.RevokedAt == nil {
+		if err := database.DB.Model(&apiKey).Update("revoked_at", time.Now()).Error; err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"ok":    false,
+				"error": "Failed to revoke API key",
+			})
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"ok":      true,
+		"message": "API key revoked successfully",
+	})
+}
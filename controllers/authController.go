@@ -1,21 +1,25 @@
 package controllers
 
 import (
-	"encoding/base64"
+	"errors"
 	"fmt"
-	"io"
-	"net/http"
+	"log"
+	"net/mail"
+	"net/url"
 	"os"
+	"review-products/auth"
 	"review-products/database"
+	"review-products/mailer"
+	"review-products/middleware"
 	"review-products/models"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
-var jwtSecret = []byte(os.Getenv("CORS_ALLOW_SECRET"))
-
 func LoginHandler(c *fiber.Ctx) error {
 	type LoginInput struct {
 		Email    string `json:"email"`
@@ -31,31 +35,172 @@ func LoginHandler(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Email and Password are required"})
 	}
 
+	if ok, err := checkLoginLock(c, input.Email); !ok {
+		return err
+	}
+
 	var user models.User
 	if err := database.DB.Where("email = ?", input.Email).First(&user).Error; err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "User not found"})
+		// ใช้เวลาเท่ากับการเช็ครหัสผ่านจริง เพื่อไม่ให้เดาได้ว่ามี email นี้หรือไม่
+		auth.SimulatePasswordCheck(input.Password)
+		return invalidCredentials(c, input.Email)
 	}
 
 	// ตรวจสอบรหัสผ่าน
-	if err := bcrypt.CompareHashAndPassword([]byte(*&user.Password), []byte(input.Password)); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Incorrect password"})
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
+		return invalidCredentials(c, input.Email)
+	}
+
+	// บัญชีที่เปิด TOTP ใช้ตัวนับเดียวกันกับการเดารหัส 6 หลัก จึงล้างได้หลังผ่าน
+	// ขั้นที่สองใน VerifyMFAHandler เท่านั้น ไม่งั้นรู้รหัสผ่านก็รีเซ็ต backoff ได้เรื่อยๆ
+	if user.TOTPEnabledAt == nil {
+		if err := auth.ResetLoginFailures(user.Email); err != nil {
+			log.Printf("Failed to reset login failures for %s: %v", user.Email, err)
+		}
+	}
+
+	// อัปเกรด hash เมื่อ BCRYPT_COST สูงกว่าตอนที่สร้าง hash เดิม
+	if auth.NeedsRehash(user.Password) {
+		if hash, err := auth.HashPassword(input.Password); err == nil {
+			if err := database.DB.Model(&user).Update("password_hash", hash).Error; err != nil {
+				log.Printf("Failed to rehash password for %s: %v", user.Email, err)
+			}
+		}
+	}
+
+	return completeLogin(c, &user)
+}
+
+// checkLoginLock writes a 429 with Retry-After and returns false while the
+// email or client IP is locked out.
+func checkLoginLock(c *fiber.Ctx, email string) (bool, error) {
+	wait, err := auth.LoginRetryAfter(email, c.IP())
+	if err != nil {
+		return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"ok": false, "error": "Could not log in"})
+	}
+
+	if wait > 0 {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(wait.Seconds())+1))
+		return false, c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"ok": false, "error": "Too many failed attempts, please try again later"})
+	}
+
+	return true, nil
+}
+
+// invalidCredentials is the single response for unknown emails and wrong
+// passwords alike.
+func invalidCredentials(c *fiber.Ctx, email string) error {
+	if err := auth.RecordLoginFailure(email, c.IP()); err != nil {
+		log.Printf("Failed to record login failure: %v", err)
+	}
+
+	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"ok": false, "error": "Invalid email or password"})
+}
+
+// completeLogin runs after the first factor succeeded. Users with TOTP
+// enabled get a short-lived challenge token for /api/auth/mfa/verify
+// instead of real tokens.
+func completeLogin(c *fiber.Ctx, user *models.User) error {
+	if user.TOTPEnabledAt == nil {
+		return issueTokenPair(c, user)
+	}
+
+	mfaToken, err := auth.NewMFAChallengeToken(user.ID, user.Email)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not generate token"})
 	}
 
+	return c.JSON(fiber.Map{
+		"ok":           true,
+		"mfa_required": true,
+		"mfa_token":    mfaToken,
+	})
+}
+
+// issueTokenPair starts a new session for user and writes the token response.
+func issueTokenPair(c *fiber.Ctx, user *models.User) error {
 	// สร้าง JWT
-	claims := jwt.MapClaims{
-		"userId": user.ID,
-		"email":  user.Email,
+	accessToken, err := auth.NewAccessToken(user.ID, user.Email, user.SessionVersion)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not generate token"})
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signedToken, err := token.SignedString(jwtSecret)
+	refreshToken, err := auth.IssueRefreshToken(user.ID, c.Get(fiber.HeaderUserAgent), c.IP())
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not generate token"})
 	}
 
+	return writeTokens(c, accessToken, refreshToken)
+}
+
+// writeTokens keeps "token" for clients that only read the access token.
+func writeTokens(c *fiber.Ctx, accessToken, refreshToken string) error {
+	return c.JSON(fiber.Map{
+		"ok":            true,
+		"token":         accessToken,
+		"access_token":  accessToken,
+		"refresh_token": refreshToken,
+		"token_type":    "Bearer",
+		"expires_in":    int(auth.AccessTokenTTL().Seconds()),
+	})
+}
+
+func RefreshHandler(c *fiber.Ctx) error {
+	type RefreshInput struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	var input RefreshInput
+	if err := c.BodyParser(&input); err != nil || input.RefreshToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"ok": false, "error": "refresh_token is required"})
+	}
+
+	user, refreshToken, err := auth.RotateRefreshToken(input.RefreshToken, c.Get(fiber.HeaderUserAgent), c.IP())
+	if errors.Is(err, auth.ErrInvalidRefreshToken) || errors.Is(err, auth.ErrRefreshTokenReused) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"ok": false, "error": "Invalid or expired refresh token"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"ok": false, "error": "Could not refresh token"})
+	}
+
+	accessToken, err := auth.NewAccessToken(user.ID, user.Email, user.SessionVersion)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"ok": false, "error": "Could not generate token"})
+	}
+
+	return writeTokens(c, accessToken, refreshToken)
+}
+
+func LogoutHandler(c *fiber.Ctx) error {
+	type LogoutInput struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	var input LogoutInput
+	if err := c.BodyParser(&input); err != nil || input.RefreshToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"ok": false, "error": "refresh_token is required"})
+	}
+
+	if err := auth.RevokeRefreshToken(input.RefreshToken); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"ok": false, "error": "Could not log out"})
+	}
+
+	return c.JSON(fiber.Map{
+		"ok":      true,
+		"message": "Logged out successfully",
+	})
+}
+
+func LogoutAllHandler(c *fiber.Ctx) error {
+	user := middleware.CurrentUser(c)
+
+	if err := auth.RevokeAllSessions(user.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"ok": false, "error": "Could not log out"})
+	}
+
 	return c.JSON(fiber.Map{
-		"ok":    true,
-		"token": signedToken,
+		"ok":      true,
+		"message": "Logged out of all sessions",
 	})
 }
 
@@ -64,7 +209,6 @@ func RegisterHandler(c *fiber.Ctx) error {
 		Name     string `json:"name"`
 		Email    string `json:"email"`
 		Password string `json:"password"`
-		Avatar   string `json:"avatar"`
 	}
 
 	var input RegisterInput
@@ -82,33 +226,32 @@ func RegisterHandler(c *fiber.Ctx) error {
 		})
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+	if addr, err := mail.ParseAddress(input.Email); err != nil || addr.Address != input.Email {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"ok":    false,
-			"error": "Could not hash password",
+			"error": "Invalid email address",
 		})
 	}
 
-	imageURL := input.Avatar
-	if imageURL == "" {
-		imageURL = "https://www.artstation.com/artwork/6LOXLO"
+	if err := auth.ValidatePassword(input.Password, input.Email); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":    false,
+			"error": err.Error(),
+		})
 	}
 
-	// แปลงรูปเป็น base64
-	base64Image, err := loadImageAsBase64(imageURL)
+	hashedPassword, err := auth.HashPassword(input.Password)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"ok":    false,
-			"error": "Failed to load image",
+			"error": "Could not hash password",
 		})
 	}
 
 	user := models.User{
 		Name:     &input.Name,
 		Email:    input.Email,
-		Password: string(hashedPassword),
-		Avatar:   &base64Image,
+		Password: hashedPassword,
 	}
 
 	if err := database.DB.Create(&user).Error; err != nil {
@@ -118,28 +261,216 @@ func RegisterHandler(c *fiber.Ctx) error {
 		})
 	}
 
+	if err := sendVerificationEmail(&user); err != nil {
+		log.Printf("Failed to send verification email to %s: %v", user.Email, err)
+	}
+
 	return c.JSON(fiber.Map{
-		"message": "User registered successfully",
+		"message": "User registered successfully, please check your email to verify your account",
 	})
 }
 
-func loadImageAsBase64(url string) (string, error) {
-	resp, err := http.Get(url)
+func sendVerificationEmail(user *models.User) error {
+	token, err := auth.NewEmailVerificationToken(user.ID, user.Email)
 	if err != nil {
-		return "", err
+		return err
 	}
-	defer resp.Body.Close()
 
-	data, err := io.ReadAll(resp.Body)
+	link := fmt.Sprintf("%s/verify-email?token=%s", appURL(), url.QueryEscape(token))
+	err = mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf("Confirm your email address by opening the link below. It expires in %s.\n\n%s",
+			auth.EmailVerificationTTL(), link),
+	})
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	contentType := resp.Header.Get("Content-Type")
-	if contentType == "" {
-		contentType = "image/png"
+	now := time.Now()
+	user.VerificationSentAt = &now
+	return database.DB.Model(user).Update("verification_sent_at", now).Error
+}
+
+func VerifyEmailHandler(c *fiber.Ctx) error {
+	token := c.Query("token")
+	if token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"ok": false, "error": "Token is required"})
+	}
+
+	claims, err := auth.ParseEmailVerificationToken(token)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"ok": false, "error": "Invalid or expired verification link"})
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, "id = ?", claims.UserID).Error; err != nil || user.Email != claims.Email {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"ok": false, "error": "Invalid or expired verification link"})
+	}
+
+	if user.EmailVerifiedAt == nil {
+		if err := database.DB.Model(&user).Update("email_verified_at", time.Now()).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"ok": false, "error": "Could not verify email"})
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"ok":      true,
+		"message": "Email verified successfully",
+	})
+}
+
+func ResendVerificationHandler(c *fiber.Ctx) error {
+	user := middleware.CurrentUser(c)
+
+	if user.EmailVerifiedAt != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"ok": false, "error": "Email is already verified"})
+	}
+
+	// จำกัดความถี่ในการส่งอีเมลซ้ำ
+	if user.VerificationSentAt != nil {
+		wait := time.Until(user.VerificationSentAt.Add(verificationResendInterval()))
+		if wait > 0 {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(wait.Seconds())+1))
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"ok": false, "error": "Please wait before requesting another email"})
+		}
+	}
+
+	if err := sendVerificationEmail(user); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"ok": false, "error": "Could not send verification email"})
+	}
+
+	return c.JSON(fiber.Map{
+		"ok":      true,
+		"message": "Verification email sent",
+	})
+}
+
+// verificationResendInterval is read from EMAIL_VERIFICATION_RESEND_INTERVAL, default 1 minute.
+func verificationResendInterval() time.Duration {
+	return auth.DurationEnv("EMAIL_VERIFICATION_RESEND_INTERVAL", time.Minute)
+}
+
+func ForgotPasswordHandler(c *fiber.Ctx) error {
+	type ForgotInput struct {
+		Email string `json:"email"`
+	}
+
+	var input ForgotInput
+	if err := c.BodyParser(&input); err != nil || input.Email == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"ok": false, "error": "Email is required"})
+	}
+
+	// ตอบเหมือนกันทุกกรณี ไม่บอกว่ามี email นี้ในระบบหรือไม่
+	response := fiber.Map{
+		"ok":      true,
+		"message": "If the email is registered, a reset link has been sent",
+	}
+
+	var user models.User
+	if err := database.DB.Where("email = ?", input.Email).First(&user).Error; err != nil {
+		return c.JSON(response)
+	}
+
+	token, err := auth.CreatePasswordResetToken(user.ID)
+	if err != nil {
+		log.Printf("Failed to create password reset token for %s: %v", user.Email, err)
+		return c.JSON(response)
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", appURL(), url.QueryEscape(token))
+	err = mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Use the link below to reset your password. It expires in %s.\n\n%s\n\nIf you did not request this, you can ignore this email.",
+			auth.PasswordResetTTL(), link),
+	})
+	if err != nil {
+		// ตอบ 200 เหมือนกรณีอื่น ไม่งั้น error จะบอกว่า email นี้มีในระบบ
+		log.Printf("Failed to send password reset email to %s: %v", user.Email, err)
+	}
+
+	return c.JSON(response)
+}
+
+func ResetPasswordHandler(c *fiber.Ctx) error {
+	type ResetInput struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	var input ResetInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"ok": false, "error": "Invalid input"})
+	}
+
+	if input.Token == "" || input.Password == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"ok": false, "error": "Token and password are required"})
+	}
+
+	user, err := auth.PasswordResetUser(input.Token)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"ok": false, "error": "Invalid or expired reset token"})
+	}
+
+	if err := auth.ValidatePassword(input.Password, user.Email); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"ok": false, "error": err.Error()})
+	}
+
+	hashedPassword, err := auth.HashPassword(input.Password)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"ok": false, "error": "Could not hash password"})
+	}
+
+	userID, err := auth.ConsumePasswordResetToken(input.Token)
+	if errors.Is(err, auth.ErrInvalidResetToken) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"ok": false, "error": "Invalid or expired reset token"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"ok": false, "error": "Could not reset password"})
+	}
+
+	if err := database.DB.Model(&models.User{}).Where("id = ?", userID).
+		Update("password_hash", hashedPassword).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"ok": false, "error": "Could not reset password"})
+	}
+
+	// ออกจากระบบทุก session หลังเปลี่ยนรหัสผ่าน
+	if err := auth.RevokeAllSessions(userID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"ok": false, "error": "Could not revoke sessions"})
+	}
+
+	// คนที่ผูก OIDC ไว้ก่อนเจ้าของ email จะได้เข้าบัญชีต่อไม่ได้
+	if err := database.DB.Where("user_id = ?", userID).Delete(&models.UserIdentity{}).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"ok": false, "error": "Could not unlink accounts"})
+	}
+
+	if err := auth.ResetLoginFailures(user.Email); err != nil {
+		log.Printf("Failed to reset login failures for %s: %v", user.Email, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"ok":      true,
+		"message": "Password has been reset",
+	})
+}
+
+// appURL is the base URL of the web client used in emailed links.
+func appURL() string {
+	if v := os.Getenv("APP_URL"); v != "" {
+		return strings.TrimRight(v, "/")
+	}
+	return "http://localhost:3000"
+}
+
+// JWKSHandler publishes the public signing keys so other services can
+// verify tokens issued here.
+func JWKSHandler(c *fiber.Ctx) error {
+	jwks, err := auth.JWKS()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"ok": false, "error": "Signing keys are not available"})
 	}
 
-	base64Str := base64.StdEncoding.EncodeToString(data)
-	return fmt.Sprintf("data:%s;base64,%s", contentType, base64Str), nil
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.JSON(jwks)
 }
@@ -0,0 +1,463 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"review-products/database"
+	"review-products/models"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// descendantsSQL selects the ID of a category and of everything below it.
+const descendantsSQL = `WITH RECURSIVE tree AS (
+	SELECT id FROM categories WHERE id = ?
+	UNION
+	SELECT categories.id FROM categories JOIN tree ON categories.parent_id = tree.id
+) SELECT id FROM tree`
+
+var slugSeparators = regexp.MustCompile(`[^\p{L}\p{M}\p{N}]+`)
+
+// slugify lowercases s and joins its words with "-". Thai and other
+// scripts are kept as is.
+func slugify(s string) string {
+	return strings.Trim(slugSeparators.ReplaceAllString(strings.ToLower(s), "-"), "-")
+}
+
+// GetCategories returns the whole category tree.
+func GetCategories(c *fiber.Ctx) error {
+	var categories []models.Category
+	if err := database.DB.Order("position, name").Find(&categories).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Failed to load categories",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"ok":         true,
+		"categories": categoryTree(categories, nil),
+	})
+}
+
+// categoryTree nests categories (already in display order) under parent.
+func categoryTree(categories []models.Category, parent *uuid.UUID) []models.Category {
+	nodes := []models.Category{}
+	for _, category := range categories {
+		if (parent == nil) != (category.ParentID == nil) {
+			continue
+		}
+		if parent != nil && *category.ParentID != *parent {
+			continue
+		}
+		category.Children = categoryTree(categories, &category.ID)
+		nodes = append(nodes, category)
+	}
+	return nodes
+}
+
+func CreateCategory(c *fiber.Ctx) error {
+	type Input struct {
+		Name     string     `json:"name"`
+		Slug     string     `json:"slug"`
+		ParentID *uuid.UUID `json:"parentId"`
+		Position *int       `json:"position"`
+	}
+
+	var input Input
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Invalid JSON body",
+		})
+	}
+
+	category := models.Category{
+		Name:     strings.TrimSpace(input.Name),
+		Slug:     slugify(input.Slug),
+		ParentID: input.ParentID,
+	}
+	if category.Name == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Name is required",
+		})
+	}
+	if category.Slug == "" {
+		category.Slug = slugify(category.Name)
+	}
+	if category.Slug == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Slug must contain letters or digits",
+		})
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := checkCategorySlug(tx, category.Slug, nil); err != nil {
+			return err
+		}
+		if err := checkCategoryParent(tx, category.ParentID, nil); err != nil {
+			return err
+		}
+
+		if input.Position != nil {
+			category.Position = *input.Position
+		} else if err := nextCategoryPosition(tx, category.ParentID, &category.Position); err != nil {
+			return err
+		}
+
+		return tx.Create(&category).Error
+	})
+	if err != nil {
+		return categoryError(c, err)
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"ok":       true,
+		"category": category,
+	})
+}
+
+func UpdateCategory(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Invalid category ID format",
+		})
+	}
+
+	// parentId: null ย้ายไปเป็นหมวดบนสุด ส่วนถ้าไม่ส่งมาเลยจะไม่เปลี่ยน
+	type Input struct {
+		Name     *string         `json:"name"`
+		Slug     *string         `json:"slug"`
+		ParentID json.RawMessage `json:"parentId"`
+		Position *int            `json:"position"`
+	}
+
+	var input Input
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Invalid JSON body",
+		})
+	}
+
+	var category models.Category
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&category, "id = ?", id).Error; err != nil {
+			return err
+		}
+
+		if input.Name != nil {
+			category.Name = strings.TrimSpace(*input.Name)
+			if category.Name == "" {
+				return errCategoryName
+			}
+		}
+		if input.Slug != nil {
+			category.Slug = slugify(*input.Slug)
+			if category.Slug == "" {
+				return errCategorySlug
+			}
+		}
+		if err := checkCategorySlug(tx, category.Slug, &category.ID); err != nil {
+			return err
+		}
+
+		parentChanged := false
+		if len(input.ParentID) > 0 {
+			var parentID *uuid.UUID
+			if err := json.Unmarshal(input.ParentID, &parentID); err != nil {
+				return errCategoryParent
+			}
+			parentChanged = (parentID == nil) != (category.ParentID == nil) ||
+				(parentID != nil && *parentID != *category.ParentID)
+			category.ParentID = parentID
+		}
+		if parentChanged {
+			if err := lockCategoryTree(tx); err != nil {
+				return err
+			}
+			if err := checkCategoryParent(tx, category.ParentID, &category.ID); err != nil {
+				return err
+			}
+		}
+
+		if input.Position != nil {
+			category.Position = *input.Position
+		} else if parentChanged {
+			if err := nextCategoryPosition(tx, category.ParentID, &category.Position); err != nil {
+				return err
+			}
+		}
+
+		return tx.Select("name", "slug", "parent_id", "position", "updated_at").Save(&category).Error
+	})
+	if err != nil {
+		return categoryError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"ok":       true,
+		"category": category,
+	})
+}
+
+// DeleteCategory removes a category that has no subcategories. Products
+// still assigned to it are unassigned, not refused: they keep their other
+// categories and only lose this one.
+func DeleteCategory(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Invalid category ID format",
+		})
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var category models.Category
+		if err := tx.First(&category, "id = ?", id).Error; err != nil {
+			return err
+		}
+
+		var children int64
+		if err := tx.Model(&models.Category{}).Where("parent_id = ?", id).Count(&children).Error; err != nil {
+			return err
+		}
+		if children > 0 {
+			return errCategoryHasChildren
+		}
+
+		if err := tx.Exec("DELETE FROM product_categories WHERE category_id = ?", id).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&category).Error
+	})
+	if err != nil {
+		return categoryError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"ok":      true,
+		"message": "Category deleted",
+	})
+}
+
+// SetProductCategories replaces a product's categories with categoryIds.
+func SetProductCategories(c *fiber.Ctx) error {
+	productID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Invalid product ID format",
+		})
+	}
+
+	type Input struct {
+		CategoryIDs []uuid.UUID `json:"categoryIds"`
+	}
+
+	var input Input
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"ok":    false,
+			"error": "categoryIds must be a list of category IDs",
+		})
+	}
+
+	var product models.Product
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&product, "id = ?", productID).Error; err != nil {
+			return err
+		}
+
+		categories := []models.Category{}
+		if len(input.CategoryIDs) > 0 {
+			if err := tx.Find(&categories, "id IN ?", input.CategoryIDs).Error; err != nil {
+				return err
+			}
+		}
+		if len(categories) != len(uniqueUUIDs(input.CategoryIDs)) {
+			return errUnknownCategory
+		}
+
+		product.Categories = categories
+		return tx.Model(&product).Association("Categories").Replace(categories)
+	})
+	if err != nil {
+		return categoryError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"ok":      true,
+		"product": product,
+	})
+}
+
+type breadcrumb struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+	Slug string    `json:"slug"`
+}
+
+// categoryBreadcrumbs returns, for each category, the path from its
+// top-level ancestor down to the category itself.
+func categoryBreadcrumbs(categories []models.Category) ([][]breadcrumb, error) {
+	trails := [][]breadcrumb{}
+	if len(categories) == 0 {
+		return trails, nil
+	}
+
+	ids := make([]uuid.UUID, len(categories))
+	for i, category := range categories {
+		ids[i] = category.ID
+	}
+
+	type row struct {
+		breadcrumb
+		Leaf  uuid.UUID
+		Depth int
+	}
+
+	var rows []row
+	if err := database.DB.Raw(`
+		WITH RECURSIVE chain AS (
+			SELECT id, parent_id, name, slug, id AS leaf, 0 AS depth
+			FROM categories WHERE id IN ?
+			UNION
+			SELECT categories.id, categories.parent_id, categories.name, categories.slug, chain.leaf, chain.depth + 1
+			FROM categories JOIN chain ON categories.id = chain.parent_id
+			WHERE chain.depth < 32
+		)
+		SELECT id, name, slug, leaf, depth FROM chain ORDER BY leaf, depth DESC`, ids).
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	byLeaf := make(map[uuid.UUID][]breadcrumb, len(ids))
+	for _, r := range rows {
+		byLeaf[r.Leaf] = append(byLeaf[r.Leaf], r.breadcrumb)
+	}
+	for _, id := range ids {
+		trails = append(trails, byLeaf[id])
+	}
+	return trails, nil
+}
+
+var (
+	errCategoryName        = errors.New("category name is required")
+	errCategorySlug        = errors.New("category slug is empty")
+	errCategoryParent      = errors.New("category parent does not exist")
+	errCategoryCycle       = errors.New("category cannot be moved under itself")
+	errCategoryHasChildren = errors.New("category has subcategories")
+	errCategorySlugTaken   = errors.New("category slug is already in use")
+	errUnknownCategory     = errors.New("category does not exist")
+)
+
+func checkCategorySlug(tx *gorm.DB, slug string, self *uuid.UUID) error {
+	query := tx.Model(&models.Category{}).Where("slug = ?", slug)
+	if self != nil {
+		query = query.Where("id <> ?", *self)
+	}
+
+	var taken int64
+	if err := query.Count(&taken).Error; err != nil {
+		return err
+	}
+	if taken > 0 {
+		return errCategorySlugTaken
+	}
+	return nil
+}
+
+// checkCategoryParent makes sure parentID exists and, when moving category
+// self, is not self or one of its descendants.
+func checkCategoryParent(tx *gorm.DB, parentID, self *uuid.UUID) error {
+	if parentID == nil {
+		return nil
+	}
+
+	var exists int64
+	if err := tx.Model(&models.Category{}).Where("id = ?", *parentID).Count(&exists).Error; err != nil {
+		return err
+	}
+	if exists == 0 {
+		return errCategoryParent
+	}
+
+	if self == nil {
+		return nil
+	}
+
+	var descendants []uuid.UUID
+	if err := tx.Raw(descendantsSQL, *self).Scan(&descendants).Error; err != nil {
+		return err
+	}
+	for _, id := range descendants {
+		if id == *parentID {
+			return errCategoryCycle
+		}
+	}
+	return nil
+}
+
+// lockCategoryTree serializes category moves until tx ends. Without it two
+// concurrent moves (A under B, B under A) each pass checkCategoryParent
+// and together form a cycle.
+func lockCategoryTree(tx *gorm.DB) error {
+	return tx.Exec("SELECT pg_advisory_xact_lock(hashtext('categories'))").Error
+}
+
+func nextCategoryPosition(tx *gorm.DB, parentID *uuid.UUID, position *int) error {
+	query := tx.Model(&models.Category{}).Select("COALESCE(MAX(position), 0) + 1")
+	if parentID == nil {
+		query = query.Where("parent_id IS NULL")
+	} else {
+		query = query.Where("parent_id = ?", *parentID)
+	}
+	return query.Scan(position).Error
+}
+
+func uniqueUUIDs(ids []uuid.UUID) map[uuid.UUID]bool {
+	set := make(map[uuid.UUID]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
+
+// categoryError maps errors from the category handlers to responses.
+func categoryError(c *fiber.Ctx, err error) error {
+	status, message := 500, "Failed to save category"
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		status, message = 404, "Not found"
+	case errors.Is(err, errCategorySlugTaken), errors.Is(err, gorm.ErrDuplicatedKey):
+		// checkCategorySlug แข่งกับ request อื่นได้ unique index เป็นตัวตัดสินสุดท้าย
+		status, message = 409, "Slug is already in use"
+	case errors.Is(err, errUnknownCategory):
+		status, message = 400, "One or more categories do not exist"
+	case errors.Is(err, errCategoryName):
+		status, message = 400, "Name is required"
+	case errors.Is(err, errCategorySlug):
+		status, message = 400, "Slug must contain letters or digits"
+	case errors.Is(err, errCategoryParent):
+		status, message = 400, "Parent category does not exist"
+	case errors.Is(err, errCategoryCycle):
+		status, message = 400, "A category cannot be moved under itself or its subcategories"
+	case errors.Is(err, errCategoryHasChildren):
+		status, message = 409, "Move or delete the subcategories first"
+	}
+
+	return c.Status(status).JSON(fiber.Map{
+		"ok":    false,
+		"error": message,
+	})
+}
@@ -0,0 +1,245 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"review-products/database"
+	"review-products/imageworker"
+	"review-products/models"
+	"review-products/storage"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const originalVariant = "original"
+
+// ServeImage streams /api/images/:id/:variant, where variant is "original"
+// or one of the generated sizes. Sizes come in the ?format= asked for;
+// without it they come as WebP when the Accept header allows it and the
+// image has a WebP variant, JPEG otherwise. Objects never change under a
+// given key, so responses carry a strong ETag and are cached forever.
+func ServeImage(c *fiber.Ctx) error {
+	imageID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Invalid image ID format",
+		})
+	}
+
+	var image models.ProductImage
+	if err := database.DB.First(&image, "id = ?", imageID).Error; err != nil || image.ObjectKey == "" {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Image not found",
+		})
+	}
+
+	var key, contentType, etag string
+	if name := c.Params("variant"); name == originalVariant {
+		key = image.ObjectKey
+		contentType = originalContentType(image.ObjectKey)
+		etag = fmt.Sprintf(`"%s"`, image.ContentHash)
+	} else {
+		formats := []string{c.Query("format")}
+		switch {
+		case formats[0] == "":
+			// WebP มีเฉพาะขนาดที่เล็กกว่า JPEG จึงต้องมี JPEG เป็นตัวสำรอง
+			c.Vary(fiber.HeaderAccept)
+			formats = []string{"jpeg"}
+			if strings.Contains(c.Get(fiber.HeaderAccept), "image/webp") {
+				formats = []string{"webp", "jpeg"}
+			}
+		case imageworker.FormatContentTypes[formats[0]] == "":
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"ok":    false,
+				"error": "Format must be webp or jpeg",
+			})
+		}
+
+		var variant models.ProductImageVariant
+		for _, format := range formats {
+			err = database.DB.
+				First(&variant, "image_id = ? AND name = ? AND format = ?", image.ID, name, format).Error
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				break
+			}
+		}
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"ok":    false,
+				"error": "Image variant not found",
+			})
+		}
+
+		key = variant.ObjectKey
+		contentType = imageworker.FormatContentTypes[variant.Format]
+		etag = fmt.Sprintf(`"%s-%s-%s"`, image.ContentHash, name, variant.Format)
+	}
+
+	c.Set(fiber.HeaderETag, etag)
+	c.Set(fiber.HeaderCacheControl, "public, max-age=31536000, immutable")
+	c.Set(fiber.HeaderAcceptRanges, "bytes")
+
+	if etagMatches(c.Get(fiber.HeaderIfNoneMatch), etag) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	object, err := storage.Default.Get(c.UserContext(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Image not found",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Failed to read image",
+		})
+	}
+
+	size, err := object.Seek(0, io.SeekEnd)
+	if err != nil {
+		object.Close()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Failed to read image",
+		})
+	}
+
+	start, length := int64(0), size
+	status := fiber.StatusOK
+
+	// If-Range ที่ไม่ตรงกับ ETag ปัจจุบัน ให้ส่งไฟล์เต็มแทน
+	rangeHeader := c.Get(fiber.HeaderRange)
+	if ifRange := c.Get(fiber.HeaderIfRange); ifRange != "" && ifRange != etag {
+		rangeHeader = ""
+	}
+	if rangeHeader != "" {
+		var ok bool
+		start, length, ok = parseByteRange(rangeHeader, size)
+		if !ok {
+			object.Close()
+			c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes */%d", size))
+			return c.SendStatus(fiber.StatusRequestedRangeNotSatisfiable)
+		}
+		if length != size {
+			status = fiber.StatusPartialContent
+			c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, size))
+		}
+	}
+
+	if _, err := object.Seek(start, io.SeekStart); err != nil {
+		object.Close()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Failed to read image",
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Status(status)
+	return c.SendStream(readCloser{io.LimitReader(object, length), object}, int(length))
+}
+
+// readCloser lets the response close the storage object once the limited
+// range has been sent.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func originalContentType(key string) string {
+	ext := strings.TrimPrefix(path.Ext(key), ".")
+	for contentType, e := range imageExtensions {
+		if e == ext {
+			return contentType
+		}
+	}
+	return "application/octet-stream"
+}
+
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// parseByteRange handles a single "bytes=" range. Multiple ranges are
+// answered with the whole object, which RFC 9110 allows.
+func parseByteRange(header string, size int64) (start, length int64, ok bool) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, size, true
+	}
+
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return 0, 0, false
+	}
+
+	if first == "" {
+		// suffix range: last N bytes
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 || size == 0 {
+			return 0, 0, false
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, n, true
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, false
+	}
+
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, false
+		}
+		if end > size-1 {
+			end = size - 1
+		}
+	}
+
+	return start, end - start + 1, true
+}
+
+// imageURL is the address of ServeImage for an image or one of its variants.
+func imageURL(id uuid.UUID, variant, format string) string {
+	url := fmt.Sprintf("/api/images/%s/%s", id, variant)
+	if format != "" {
+		url += "?format=" + format
+	}
+	return url
+}
+
+// useServedImageURLs points stored images at ServeImage instead of their
+// raw storage location.
+func useServedImageURLs(images []models.ProductImage) {
+	for i := range images {
+		if images[i].ObjectKey == "" {
+			continue
+		}
+		images[i].URL = imageURL(images[i].ID, originalVariant, "")
+		for j := range images[i].Variants {
+			v := &images[i].Variants[j]
+			v.URL = imageURL(images[i].ID, v.Name, v.Format)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"review-products/auth"
+	"review-products/database"
+	"review-products/middleware"
+	"review-products/models"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+func EnrollMFAHandler(c *fiber.Ctx) error {
+	user := middleware.CurrentUser(c)
+
+	if user.TOTPEnabledAt != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"ok": false, "error": "Two-factor authentication is already enabled"})
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"ok": false, "error": "Could not generate secret"})
+	}
+
+	// เก็บ secret ไว้ก่อน จะเปิดใช้งานจริงเมื่อยืนยันรหัสผ่าน /mfa/confirm
+	if err := database.DB.Model(user).Updates(map[string]interface{}{
+		"totp_secret":    secret,
+		"totp_last_step": 0,
+	}).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"ok": false, "error": "Could not start enrollment"})
+	}
+
+	return c.JSON(fiber.Map{
+		"ok":               true,
+		"secret":           secret,
+		"provisioning_uri": auth.TOTPProvisioningURI(secret, user.Email),
+	})
+}
+
+func ConfirmMFAHandler(c *fiber.Ctx) error {
+	user := middleware.CurrentUser(c)
+
+	type ConfirmInput struct {
+		Code string `json:"code"`
+	}
+
+	var input ConfirmInput
+	if err := c.BodyParser(&input); err != nil || input.Code == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"ok": false, "error": "Code is required"})
+	}
+
+	if user.TOTPEnabledAt != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"ok": false, "error": "Two-factor authentication is already enabled"})
+	}
+	if user.TOTPSecret == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"ok": false, "error": "Start enrollment first"})
+	}
+
+	if err := auth.VerifyTOTP(user, input.Code); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"ok": false, "error": "Invalid code"})
+	}
+
+	var codes []string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("totp_enabled_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		var err error
+		codes, err = auth.ReplaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"ok": false, "error": "Could not enable two-factor authentication"})
+	}
+
+	return c.JSON(fiber.Map{
+		"ok":             true,
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+func DisableMFAHandler(c *fiber.Ctx) error {
+	user := middleware.CurrentUser(c)
+
+	if user.TOTPEnabledAt == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"ok": false, "error": "Two-factor authentication is not enabled"})
+	}
+
+	if ok, err := checkSecondFactor(c, user); !ok {
+		return err
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"totp_secret":     nil,
+			"totp_enabled_at": nil,
+			"totp_last_step":  0,
+		}).Error; err != nil {
+			return err
+		}
+
+		return tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"ok": false, "error": "Could not disable two-factor authentication"})
+	}
+
+	return c.JSON(fiber.Map{
+		"ok":      true,
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+// VerifyMFAHandler is the second step of login: it exchanges the challenge
+// token from LoginHandler plus a TOTP or recovery code for real tokens.
+func VerifyMFAHandler(c *fiber.Ctx) error {
+	type VerifyInput struct {
+		MFAToken string `json:"mfa_token"`
+	}
+
+	var input VerifyInput
+	if err := c.BodyParser(&input); err != nil || input.MFAToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"ok": false, "error": "mfa_token is required"})
+	}
+
+	claims, err := auth.ParseMFAChallengeToken(input.MFAToken)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"ok": false, "error": "Invalid or expired MFA token"})
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, "id = ?", claims.UserID).Error; err != nil || user.TOTPEnabledAt == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"ok": false, "error": "Invalid or expired MFA token"})
+	}
+
+	// รหัส 6 หลักเดาได้ จึงใช้ lockout เดียวกับการ login
+	if ok, err := checkLoginLock(c, user.Email); !ok {
+		return err
+	}
+
+	if ok, err := checkSecondFactor(c, &user); !ok {
+		return err
+	}
+
+	if err := auth.ResetLoginFailures(user.Email); err != nil {
+		log.Printf("Failed to reset login failures for %s: %v", user.Email, err)
+	}
+
+	return issueTokenPair(c, &user)
+}
+
+// checkSecondFactor reads "code" or "recovery_code" from the body. When
+// neither is valid it writes the error response and returns false; wrong
+// codes count towards the login lockout.
+func checkSecondFactor(c *fiber.Ctx, user *models.User) (bool, error) {
+	type FactorInput struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	var input FactorInput
+	if err := c.BodyParser(&input); err != nil {
+		return false, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"ok": false, "error": "Invalid input"})
+	}
+
+	var err error
+	switch {
+	case input.Code != "":
+		err = auth.VerifyTOTP(user, input.Code)
+	case input.RecoveryCode != "":
+		err = auth.UseRecoveryCode(user.ID, input.RecoveryCode)
+	default:
+		return false, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"ok": false, "error": "Code or recovery_code is required"})
+	}
+
+	if errors.Is(err, auth.ErrInvalidMFACode) {
+		if err := auth.RecordLoginFailure(user.Email, c.IP()); err != nil {
+			log.Printf("Failed to record login failure: %v", err)
+		}
+		return false, c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"ok": false, "error": "Invalid code"})
+	}
+	if err != nil {
+		return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"ok": false, "error": "Could not verify code"})
+	}
+
+	return true, nil
+}
@@ -0,0 +1,286 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"review-products/auth"
+	"review-products/database"
+	"review-products/middleware"
+	"review-products/models"
+	"review-products/oidc"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	oauthStateTTL    = 10 * time.Minute
+	oauthStateCookie = "oidc_state"
+)
+
+// OIDCStartHandler redirects the browser to the provider's login page.
+func OIDCStartHandler(c *fiber.Ctx) error {
+	provider, ok := oidc.Get(c.Params("provider"))
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"ok": false, "error": "Unknown provider"})
+	}
+
+	authURL, err := newAuthorizationURL(c, provider, nil)
+	if err != nil {
+		log.Printf("OIDC start failed for %s: %v", provider.Name, err)
+		return c.Status(502).JSON(fiber.Map{"ok": false, "error": "Could not reach identity provider"})
+	}
+
+	return c.Redirect(authURL, fiber.StatusFound)
+}
+
+// OIDCLinkHandler returns an authorization URL that links the provider
+// account to the logged-in user when the callback completes.
+func OIDCLinkHandler(c *fiber.Ctx) error {
+	provider, ok := oidc.Get(c.Params("provider"))
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"ok": false, "error": "Unknown provider"})
+	}
+
+	user := middleware.CurrentUser(c)
+	authURL, err := newAuthorizationURL(c, provider, &user.ID)
+	if err != nil {
+		log.Printf("OIDC link failed for %s: %v", provider.Name, err)
+		return c.Status(502).JSON(fiber.Map{"ok": false, "error": "Could not reach identity provider"})
+	}
+
+	return c.JSON(fiber.Map{
+		"ok":                true,
+		"authorization_url": authURL,
+	})
+}
+
+func newAuthorizationURL(c *fiber.Ctx, provider *oidc.Provider, linkUserID *uuid.UUID) (string, error) {
+	state, err := oidc.RandomString()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		return "", err
+	}
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		return "", err
+	}
+
+	authURL, err := provider.AuthCodeURL(c.UserContext(), state, nonce, challenge)
+	if err != nil {
+		return "", err
+	}
+
+	// ล้าง state ที่หมดอายุไปพร้อมกัน
+	database.DB.Where("expires_at < ?", time.Now()).Delete(&models.OAuthState{})
+
+	record := models.OAuthState{
+		StateHash:    auth.HashToken(state),
+		Provider:     provider.Name,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		LinkUserID:   linkUserID,
+		ExpiresAt:    time.Now().Add(oauthStateTTL),
+	}
+	if err := database.DB.Create(&record).Error; err != nil {
+		return "", err
+	}
+
+	setStateCookie(c, state, record.ExpiresAt)
+
+	return authURL, nil
+}
+
+// setStateCookie binds the state to the browser that started the flow.
+// Lax lets the provider's top-level redirect back carry it.
+func setStateCookie(c *fiber.Ctx, state string, expires time.Time) {
+	c.Cookie(&fiber.Cookie{
+		Name:     oauthStateCookie,
+		Value:    state,
+		Path:     "/api/auth/oidc",
+		Expires:  expires,
+		Secure:   c.Secure(),
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+}
+
+func OIDCCallbackHandler(c *fiber.Ctx) error {
+	provider, ok := oidc.Get(c.Params("provider"))
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"ok": false, "error": "Unknown provider"})
+	}
+
+	if providerErr := c.Query("error"); providerErr != "" {
+		return c.Status(400).JSON(fiber.Map{"ok": false, "error": "Sign-in was cancelled or denied: " + providerErr})
+	}
+
+	code, state := c.Query("code"), c.Query("state")
+	if code == "" || state == "" {
+		return c.Status(400).JSON(fiber.Map{"ok": false, "error": "code and state are required"})
+	}
+
+	cookieState := c.Cookies(oauthStateCookie)
+	setStateCookie(c, "", time.Unix(0, 0))
+	if subtle.ConstantTimeCompare([]byte(cookieState), []byte(state)) != 1 {
+		return c.Status(400).JSON(fiber.Map{"ok": false, "error": "Invalid or expired state"})
+	}
+
+	// state ใช้ได้ครั้งเดียว
+	var record models.OAuthState
+	if err := database.DB.Where("state_hash = ?", auth.HashToken(state)).First(&record).Error; err != nil {
+		return c.Status(400).JSON(fiber.Map{"ok": false, "error": "Invalid or expired state"})
+	}
+	result := database.DB.Delete(&models.OAuthState{}, "id = ?", record.ID)
+	if result.Error != nil || result.RowsAffected == 0 || record.Provider != provider.Name || time.Now().After(record.ExpiresAt) {
+		return c.Status(400).JSON(fiber.Map{"ok": false, "error": "Invalid or expired state"})
+	}
+
+	rawIDToken, err := provider.Exchange(c.UserContext(), code, record.CodeVerifier)
+	if err != nil {
+		log.Printf("OIDC code exchange failed for %s: %v", provider.Name, err)
+		return c.Status(502).JSON(fiber.Map{"ok": false, "error": "Could not complete sign-in with identity provider"})
+	}
+
+	claims, err := provider.VerifyIDToken(c.UserContext(), rawIDToken, record.Nonce)
+	if err != nil {
+		log.Printf("OIDC id_token rejected for %s: %v", provider.Name, err)
+		return c.Status(401).JSON(fiber.Map{"ok": false, "error": "Invalid identity token"})
+	}
+
+	if record.LinkUserID != nil {
+		return linkIdentity(c, provider.Name, *record.LinkUserID, claims)
+	}
+
+	return signInWithIdentity(c, provider.Name, claims)
+}
+
+func linkIdentity(c *fiber.Ctx, provider string, userID uuid.UUID, claims *oidc.IDClaims) error {
+	var existing models.UserIdentity
+	err := database.DB.Where("provider = ? AND subject = ?", provider, claims.Subject).First(&existing).Error
+	if err == nil {
+		if existing.UserID != userID {
+			return c.Status(409).JSON(fiber.Map{"ok": false, "error": "This account is already linked to another user"})
+		}
+		return c.JSON(fiber.Map{"ok": true, "message": "Account already linked"})
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(500).JSON(fiber.Map{"ok": false, "error": "Failed to link account"})
+	}
+
+	identity := models.UserIdentity{
+		UserID:   userID,
+		Provider: provider,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	}
+	if err := database.DB.Create(&identity).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"ok": false, "error": "Failed to link account"})
+	}
+
+	return c.JSON(fiber.Map{
+		"ok":      true,
+		"message": "Account linked successfully",
+	})
+}
+
+// signInWithIdentity applies the linking rules:
+//  1. a known identity signs in its user;
+//  2. a verified provider email matching a local user with a verified
+//     email is linked automatically;
+//  3. a matching local user whose email is not verified is refused, since
+//     whoever registered it may not own the address;
+//  4. otherwise a new user is created, but only for a verified provider
+//     email; an unverified one could claim someone else's address before
+//     they register.
+func signInWithIdentity(c *fiber.Ctx, provider string, claims *oidc.IDClaims) error {
+	var identity models.UserIdentity
+	err := database.DB.Where("provider = ? AND subject = ?", provider, claims.Subject).First(&identity).Error
+	if err == nil {
+		var user models.User
+		if err := database.DB.First(&user, "id = ?", identity.UserID).Error; err != nil {
+			return c.Status(500).JSON(fiber.Map{"ok": false, "error": "Failed to sign in"})
+		}
+		return completeLogin(c, &user)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(500).JSON(fiber.Map{"ok": false, "error": "Failed to sign in"})
+	}
+
+	if claims.Email == "" {
+		return c.Status(400).JSON(fiber.Map{"ok": false, "error": "Identity provider did not share an email address"})
+	}
+
+	var user models.User
+	err = database.DB.Where("email = ?", claims.Email).First(&user).Error
+	switch {
+	case err == nil:
+		if !bool(claims.EmailVerified) || user.EmailVerifiedAt == nil {
+			return c.Status(409).JSON(fiber.Map{
+				"ok":    false,
+				"error": "An account with this email already exists. Log in with your password and link " + provider + " from your account",
+			})
+		}
+
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		if !bool(claims.EmailVerified) {
+			return c.Status(403).JSON(fiber.Map{
+				"ok":    false,
+				"error": provider + " has not verified this email address",
+			})
+		}
+		user, err = newOIDCUser(claims)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"ok": false, "error": "Failed to create user"})
+		}
+
+	default:
+		return c.Status(500).JSON(fiber.Map{"ok": false, "error": "Failed to sign in"})
+	}
+
+	identity = models.UserIdentity{
+		UserID:   user.ID,
+		Provider: provider,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	}
+	if err := database.DB.Create(&identity).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"ok": false, "error": "Failed to link account"})
+	}
+
+	return completeLogin(c, &user)
+}
+
+// newOIDCUser creates a user with a random password nobody knows; they
+// can set one later through the password reset flow.
+func newOIDCUser(claims *oidc.IDClaims) (models.User, error) {
+	randomPassword, err := auth.RandomToken(32)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	hashedPassword, err := auth.HashPassword(randomPassword)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	// signInWithIdentity only gets here with a verified provider email
+	now := time.Now()
+	user := models.User{
+		Email:           claims.Email,
+		Password:        hashedPassword,
+		EmailVerifiedAt: &now,
+	}
+	if claims.Name != "" {
+		user.Name = &claims.Name
+	}
+
+	err = database.DB.Create(&user).Error
+	return user, err
+}
@@ -1,12 +1,18 @@
 package controllers
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
 	"review-products/database"
 	"review-products/models"
 	"strconv"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 func CreateProduct(c *fiber.Ctx) error {
@@ -55,6 +61,10 @@ func CreateProduct(c *fiber.Ctx) error {
 		})
 	}
 
+	if err := indexProduct(database.DB, &product); err != nil {
+		log.Printf("⚠️ Failed to index product %s for search: %v", product.ID, err)
+	}
+
 	return c.JSON(fiber.Map{
 		"ok":      true,
 		"message": "Product created successfully",
@@ -62,31 +72,196 @@ func CreateProduct(c *fiber.Ctx) error {
 	})
 }
 
+// productSorts maps ?sort= to the column it orders by and the cast applied
+// to cursor values so they compare with the column's type.
+var productSorts = map[string]struct {
+	expr string
+	cast string
+}{
+	"created_at": {"products.created_at", "timestamptz"},
+	"price":      {"products.price", "numeric"},
+	"name":       {"products.name", "text"},
+	"rating":     {"COALESCE(ratings.average_rating, 0)", "numeric"},
+}
+
+const ratingsJoin = `LEFT JOIN (
+	SELECT product_id, ROUND(AVG(rating)::numeric, 2) AS average_rating, COUNT(*) AS review_count
+	FROM reviews GROUP BY product_id
+) AS ratings ON ratings.product_id = products.id::text`
+
+// productCursor marks the last product of a page: its sort value and ID.
+type productCursor struct {
+	Value string    `json:"v"`
+	ID    uuid.UUID `json:"id"`
+}
+
+// GetAllProducts lists products a page at a time.
+//
+//	limit            page size, 1-100 (default 20)
+//	cursor           next_cursor from the previous page
+//	sort             created_at (default), price, name or rating
+//	order            asc or desc (default desc for created_at and rating, asc otherwise)
+//	min_price, max_price, min_rating, in_stock=true   filters
+//	category         category slug; includes products in its subcategories
+//	include_reviews  "false" leaves out each product's reviews
 func GetAllProducts(c *fiber.Ctx) error {
-	var products []models.Product
+	sortName := c.Query("sort", "created_at")
+	sort, ok := productSorts[sortName]
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{
+			"ok":    false,
+			"error": "sort must be one of created_at, price, name, rating",
+		})
+	}
 
-	result := database.DB.Preload("Images").Find(&products)
-	if result.Error != nil {
-		return c.Status(404).SendString("Product not found")
+	order := c.Query("order")
+	if order == "" {
+		order = "asc"
+		if sortName == "created_at" || sortName == "rating" {
+			order = "desc"
+		}
+	}
+	if order != "asc" && order != "desc" {
+		return c.Status(400).JSON(fiber.Map{
+			"ok":    false,
+			"error": "order must be asc or desc",
+		})
 	}
 
-	if err := database.DB.
-		Preload("Images").
-		Preload("Review").
-		Preload("Review.User").
-		Find(&products).Error; err != nil {
-		return c.Status(404).JSON(fiber.Map{
+	limit := c.QueryInt("limit", 20)
+	if limit < 1 || limit > 100 {
+		return c.Status(400).JSON(fiber.Map{
 			"ok":    false,
-			"error": "Product not found",
+			"error": "limit must be between 1 and 100",
 		})
 	}
 
+	query := database.DB.Model(&models.Product{}).Joins(ratingsJoin)
+
+	for param, condition := range map[string]string{
+		"min_price":  "products.price >= ?",
+		"max_price":  "products.price <= ?",
+		"min_rating": "COALESCE(ratings.average_rating, 0) >= ?",
+	} {
+		if raw := c.Query(param); raw != "" {
+			value, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				return c.Status(400).JSON(fiber.Map{
+					"ok":    false,
+					"error": param + " must be a number",
+				})
+			}
+			query = query.Where(condition, value)
+		}
+	}
+	if c.QueryBool("in_stock") {
+		query = query.Where("products.stock > 0")
+	}
+	if slug := c.Query("category"); slug != "" {
+		var category models.Category
+		if err := database.DB.First(&category, "slug = ?", slug).Error; err != nil {
+			return c.Status(404).JSON(fiber.Map{
+				"ok":    false,
+				"error": "Category not found",
+			})
+		}
+		query = query.Where(
+			"products.id IN (SELECT product_id FROM product_categories WHERE category_id IN ("+descendantsSQL+"))",
+			category.ID,
+		)
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Failed to load products",
+		})
+	}
+
+	if raw := c.Query("cursor"); raw != "" {
+		cursor, err := decodeProductCursor(raw)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"ok":    false,
+				"error": "Invalid cursor",
+			})
+		}
+
+		op := ">"
+		if order == "desc" {
+			op = "<"
+		}
+		query = query.Where(
+			fmt.Sprintf("(%s, products.id) %s (?::%s, ?)", sort.expr, op, sort.cast),
+			cursor.Value, cursor.ID,
+		)
+	}
+
+	query = query.
+		Select("products.*, COALESCE(ratings.average_rating, 0) AS average_rating, COALESCE(ratings.review_count, 0) AS review_count").
+		Order(fmt.Sprintf("%s %s, products.id %s", sort.expr, order, order)).
+		Limit(limit+1).
+		Preload("Images", func(db *gorm.DB) *gorm.DB { return db.Order("position") }).
+		Preload("Images.Variants")
+	if c.Query("include_reviews") != "false" {
+		query = query.Preload("Review").Preload("Review.User")
+	}
+
+	products := []models.Product{}
+	if err := query.Find(&products).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Failed to load products",
+		})
+	}
+
+	var nextCursor *string
+	if len(products) > limit {
+		products = products[:limit]
+		cursor := encodeProductCursor(sortName, products[limit-1])
+		nextCursor = &cursor
+	}
+
+	for i := range products {
+		useServedImageURLs(products[i].Images)
+	}
+
 	return c.JSON(fiber.Map{
-		"ok":       true,
-		"products": products,
+		"ok":          true,
+		"products":    products,
+		"total":       total,
+		"next_cursor": nextCursor,
 	})
 }
 
+func encodeProductCursor(sortName string, product models.Product) string {
+	cursor := productCursor{ID: product.ID}
+	switch sortName {
+	case "price":
+		cursor.Value = strconv.FormatFloat(product.Price, 'f', 2, 64)
+	case "name":
+		cursor.Value = product.Name
+	case "rating":
+		cursor.Value = strconv.FormatFloat(product.AverageRating, 'f', 2, 64)
+	default:
+		cursor.Value = product.CreatedAt.Format(time.RFC3339Nano)
+	}
+
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeProductCursor(raw string) (productCursor, error) {
+	var cursor productCursor
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return cursor, err
+	}
+	err = json.Unmarshal(data, &cursor)
+	return cursor, err
+}
+
 func GetProductById(c *fiber.Ctx) error {
 	id := c.Query("id")
 	if id == "" {
@@ -107,9 +282,10 @@ func GetProductById(c *fiber.Ctx) error {
 	var product models.Product
 
 	if err := database.DB.
-		Preload("Images").
+		Preload("Images.Variants").
 		Preload("Review").
 		Preload("Review.User").
+		Preload("Categories", func(db *gorm.DB) *gorm.DB { return db.Order("position, name") }).
 		First(&product, "id = ?", id).Error; err != nil {
 		return c.Status(404).JSON(fiber.Map{
 			"ok":    false,
@@ -117,9 +293,20 @@ func GetProductById(c *fiber.Ctx) error {
 		})
 	}
 
+	useServedImageURLs(product.Images)
+
+	breadcrumbs, err := categoryBreadcrumbs(product.Categories)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Failed to load categories",
+		})
+	}
+
 	return c.JSON(fiber.Map{
-		"ok":      true,
-		"product": product,
+		"ok":          true,
+		"product":     product,
+		"breadcrumbs": breadcrumbs,
 	})
 }
 
@@ -178,7 +365,20 @@ func UpdateProduct(c *fiber.Ctx) error {
 		}
 	}
 
-	if err := database.DB.Save(&product).Error; err != nil {
+	product.SKU = &input.SKU
+	product.Name = input.Name
+	product.Description = &input.Description
+	product.Price = float64(input.Price)
+	product.Stock = input.Stock
+
+	// บันทึกกับ search vector ใน transaction เดียวกัน ผลค้นหาจะไม่ค้างข้อมูลเก่า
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&product).Error; err != nil {
+			return err
+		}
+		return indexProduct(tx, &product)
+	})
+	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"ok":    false,
 			"error": "Failed to update product",
@@ -217,7 +417,14 @@ func DeleteProduct(c *fiber.Ctx) error {
 		})
 	}
 
-	if err := database.DB.Delete(&product).Error; err != nil {
+	// product_categories อ้างถึง product ด้วย foreign key ต้องลบก่อน
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&product).Association("Categories").Clear(); err != nil {
+			return err
+		}
+		return tx.Delete(&product).Error
+	})
+	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"ok":    false,
 			"error": "Failed to delete Product",
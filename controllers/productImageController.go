@@ -1,11 +1,35 @@
 package controllers
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"os"
 	"review-products/database"
+	"review-products/fetcher"
+	"review-products/imageworker"
+	"review-products/imaging"
 	"review-products/models"
+	"review-products/storage"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	maxImageBytes      = 10 * 1024 * 1024
+	maxImagesPerUpload = 10
 )
 
 func UploadProductImage(c *fiber.Ctx) error {
@@ -30,11 +54,9 @@ func UploadProductImage(c *fiber.Ctx) error {
 		})
 	}
 
-	// แปลงรูปเป็น Base64
-	base64Image, err := loadImageAsBase64(input.URL)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to load image",
+	if input.URL == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "URL is required",
 		})
 	}
 
@@ -45,31 +67,920 @@ func UploadProductImage(c *fiber.Ctx) error {
 		})
 	}
 
-	var lastImage models.ProductImage
-	position := 1
+	data, _, err := fetcher.Default.FetchImage(c.UserContext(), input.URL)
+	switch {
+	case errors.Is(err, fetcher.ErrDisallowedURL), errors.Is(err, fetcher.ErrBlockedAddress):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Image URL is not allowed",
+		})
+	case errors.Is(err, fetcher.ErrTooLarge):
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+			"error": "Image is too large",
+		})
+	case errors.Is(err, fetcher.ErrNotImage):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "URL does not point to an image",
+		})
+	case err != nil:
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "Failed to load image",
+		})
+	}
 
-	if err := database.DB.
-		Where("product_id = ?", productUUID).
-		Order("position DESC").
-		First(&lastImage).Error; err == nil {
-		position = lastImage.Position + 1
+	normalized, err := imaging.Normalize(data)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "URL does not point to a supported image",
+		})
 	}
 
-	productImage := models.ProductImage{
-		ProductID: input.ProductID,
-		URL:       base64Image,
-		Alt:       &input.Alt,
-		Position:  position,
+	object, err := storeProductImage(c.UserContext(), normalized)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to store image",
+		})
 	}
 
-	if err := database.DB.Create(&productImage).Error; err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+	image := object.productImage()
+	image.Alt = &input.Alt
+	images := []models.ProductImage{image}
+
+	saved, duplicates, err := appendProductImages(c.UserContext(), productUUID, images, []storedObject{object})
+	if err != nil {
+		discardStoredObjects(object)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Product not found",
+			})
+		}
+		if errors.Is(err, errDuplicateImage) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "This image has already been uploaded for the product",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to save product image",
 		})
 	}
 
+	if len(saved) == 0 {
+		useServedImageURLs(duplicates)
+		return c.JSON(fiber.Map{
+			"ok":        true,
+			"message":   "Image already exists for this product",
+			"duplicate": true,
+			"image":     duplicates[0],
+		})
+	}
+
+	imageworker.Enqueue(saved[0].ID)
+	useServedImageURLs(saved)
+
 	return c.JSON(fiber.Map{
 		"ok":      true,
 		"message": "Upload image successfully",
+		"image":   saved[0],
+	})
+}
+
+// UploadProductImageFiles accepts multipart/form-data with one or more
+// "files" parts and optional "alt" values in the same order.
+func UploadProductImageFiles(c *fiber.Ctx) error {
+	productUUID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Invalid product ID format",
+		})
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Expected multipart/form-data",
+		})
+	}
+
+	files := form.File["files"]
+	if len(files) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":    false,
+			"error": "At least one file is required",
+		})
+	}
+	if len(files) > maxImagesPerUpload {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":    false,
+			"error": fmt.Sprintf("At most %d files per upload", maxImagesPerUpload),
+		})
+	}
+
+	alts := form.Value["alt"]
+	images := make([]models.ProductImage, 0, len(files))
+
+	// ตรวจทุกไฟล์ก่อน ถ้ามีไฟล์ไหนไม่ผ่านจะไม่บันทึกเลย
+	uploads := make([]imaging.Normalized, 0, len(files))
+	for _, file := range files {
+		if file.Size > maxImageBytes {
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+				"ok":    false,
+				"error": file.Filename + " is larger than 10MB",
+			})
+		}
+
+		data, err := readFormFile(file, maxImageBytes)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"ok":    false,
+				"error": "Could not read " + file.Filename,
+			})
+		}
+
+		normalized, err := imaging.Normalize(data)
+		if err != nil {
+			return c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{
+				"ok":    false,
+				"error": file.Filename + " is not a supported image (jpeg, png, gif, webp)",
+			})
+		}
+
+		uploads = append(uploads, normalized)
+	}
+
+	objects := make([]storedObject, 0, len(uploads))
+	for i, u := range uploads {
+		object, err := storeProductImage(c.UserContext(), u)
+		if err != nil {
+			discardStoredObjects(objects...)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"ok":    false,
+				"error": "Failed to store image",
+			})
+		}
+
+		image := object.productImage()
+		if i < len(alts) && alts[i] != "" {
+			alt := alts[i]
+			image.Alt = &alt
+		}
+		images = append(images, image)
+		objects = append(objects, object)
+	}
+
+	saved, duplicates, err := appendProductImages(c.UserContext(), productUUID, images, objects)
+	if err != nil {
+		discardStoredObjects(objects...)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"ok":    false,
+				"error": "Product not found",
+			})
+		}
+		if errors.Is(err, errDuplicateImage) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"ok":    false,
+				"error": "One or more images have already been uploaded for the product",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Failed to save product images",
+		})
+	}
+	for _, image := range saved {
+		imageworker.Enqueue(image.ID)
+	}
+	useServedImageURLs(saved)
+	useServedImageURLs(duplicates)
+
+	return c.JSON(fiber.Map{
+		"ok":         true,
+		"message":    "Upload images successfully",
+		"images":     saved,
+		"duplicates": duplicates,
+	})
+}
+
+func readFormFile(file *multipart.FileHeader, limit int64) ([]byte, error) {
+	f, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("file exceeds %d bytes", limit)
+	}
+	return data, nil
+}
+
+var errDuplicateImage = errors.New("image already uploaded for this product")
+
+// duplicateImagePolicy reads DUPLICATE_IMAGE_POLICY: "reject" (default)
+// fails the upload with 409, "dedupe" skips the file and returns the
+// image the product already has.
+func duplicateImagePolicy() string {
+	if os.Getenv("DUPLICATE_IMAGE_POLICY") == "dedupe" {
+		return "dedupe"
+	}
+	return "reject"
+}
+
+// appendProductImages gives images the next positions after the product's
+// existing images and saves them. The product row is locked for the
+// transaction so concurrent uploads cannot pick the same position or both
+// add the same file.
+//
+// Images whose content hash the product already has (or that repeat within
+// the batch) are handled by duplicateImagePolicy; with "dedupe" the
+// matching stored images are returned as duplicates. objects are the
+// stored files behind images, checked by ensureStoredObjects before the
+// rows are written.
+func appendProductImages(ctx context.Context, productID uuid.UUID, images []models.ProductImage, objects []storedObject) (saved, duplicates []models.ProductImage, err error) {
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var product models.Product
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&product, "id = ?", productID).Error; err != nil {
+			return err
+		}
+
+		hashes := make([]string, 0, len(images))
+		for _, image := range images {
+			hashes = append(hashes, image.ContentHash)
+		}
+
+		var existing []models.ProductImage
+		if err := tx.Where("product_id = ? AND content_hash IN ?", productID.String(), hashes).
+			Find(&existing).Error; err != nil {
+			return err
+		}
+		known := make(map[string]*models.ProductImage, len(existing))
+		for i := range existing {
+			known[existing[i].ContentHash] = &existing[i]
+		}
+
+		saved = make([]models.ProductImage, 0, len(images))
+		var repeated []string
+		for _, image := range images {
+			if match, ok := known[image.ContentHash]; ok {
+				if match != nil {
+					duplicates = append(duplicates, *match)
+				} else {
+					repeated = append(repeated, image.ContentHash)
+				}
+				continue
+			}
+			known[image.ContentHash] = nil
+			saved = append(saved, image)
+		}
+
+		if len(saved) < len(images) && duplicateImagePolicy() == "reject" {
+			return errDuplicateImage
+		}
+		if len(saved) == 0 {
+			return nil
+		}
+
+		var last int
+		if err := tx.Model(&models.ProductImage{}).
+			Where("product_id = ?", productID.String()).
+			Select("COALESCE(MAX(position), 0)").
+			Scan(&last).Error; err != nil {
+			return err
+		}
+
+		for i := range saved {
+			saved[i].ProductID = productID.String()
+			saved[i].Position = last + i + 1
+		}
+
+		if err := ensureStoredObjects(ctx, tx, objects...); err != nil {
+			return err
+		}
+
+		if err := tx.Create(&saved).Error; err != nil {
+			return err
+		}
+
+		// ไฟล์ที่ซ้ำกันเองใน batch เดียวกัน ให้ชี้ไปที่รูปที่เพิ่งบันทึก
+		for _, hash := range repeated {
+			for _, image := range saved {
+				if image.ContentHash == hash {
+					duplicates = append(duplicates, image)
+					break
+				}
+			}
+		}
+		return nil
+	})
+	return saved, duplicates, err
+}
+
+type storedObject struct {
+	Key            string
+	URL            string
+	Hash           string
+	PerceptualHash *int64
+	Width          int
+	Height         int
+	BlurHash       string
+	DominantColor  string
+	// Created is set when storeProductImage wrote the object rather than
+	// reusing one that was already stored.
+	Created bool
+
+	// data is kept so ensureStoredObjects can write the object again.
+	data        []byte
+	contentType string
+}
+
+var imageExtensions = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+	"image/webp": "webp",
+}
+
+// productImage is a new, unsaved row for the stored object.
+func (o storedObject) productImage() models.ProductImage {
+	now := time.Now()
+	return models.ProductImage{
+		URL:            o.URL,
+		ObjectKey:      o.Key,
+		ContentHash:    o.Hash,
+		PerceptualHash: o.PerceptualHash,
+		Width:          o.Width,
+		Height:         o.Height,
+		BlurHash:       o.BlurHash,
+		DominantColor:  o.DominantColor,
+		NormalizedAt:   &now,
+	}
+}
+
+// columns points an existing product_images row at the stored object.
+func (o storedObject) columns() map[string]interface{} {
+	return map[string]interface{}{
+		"url":             o.URL,
+		"object_key":      o.Key,
+		"content_hash":    o.Hash,
+		"perceptual_hash": o.PerceptualHash,
+		"width":           o.Width,
+		"height":          o.Height,
+		"blur_hash":       o.BlurHash,
+		"dominant_color":  o.DominantColor,
+		"normalized_at":   time.Now(),
+	}
+}
+
+// storeProductImage stores a normalized image under
+// products/<sha256>.<ext>. Identical files map to the same key, so an
+// object that already exists is reused. It also returns the image's
+// dimensions, placeholder data and perceptual hash for near-duplicate
+// search.
+func storeProductImage(ctx context.Context, n imaging.Normalized) (storedObject, error) {
+	data, contentType := n.Data, n.ContentType
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	key := fmt.Sprintf("products/%s.%s", hash, imageExtensions[contentType])
+
+	exists, err := storage.Default.Exists(ctx, key)
+	if err != nil {
+		return storedObject{}, err
+	}
+	if !exists {
+		if err := storage.Default.Put(ctx, key, bytes.NewReader(data), int64(len(data)), contentType); err != nil {
+			return storedObject{}, err
+		}
+	}
+
+	b := n.Image.Bounds()
+	dhash := int64(imaging.DHash(n.Image))
+	return storedObject{
+		Key:            key,
+		URL:            storage.Default.URL(key),
+		Hash:           hash,
+		PerceptualHash: &dhash,
+		Width:          b.Dx(),
+		Height:         b.Dy(),
+		BlurHash:       imaging.BlurHash(n.Image),
+		DominantColor:  imaging.DominantColor(n.Image),
+		Created:        !exists,
+		data:           data,
+		contentType:    contentType,
+	}, nil
+}
+
+// ensureStoredObjects runs in the transaction that saves rows referencing
+// objects. storeProductImage may have skipped the Put because the object
+// existed, and a deleter that saw no references may have removed it since;
+// under the lock the object is checked again and rewritten if needed.
+func ensureStoredObjects(ctx context.Context, tx *gorm.DB, objects ...storedObject) error {
+	// ล็อกตามลำดับ hash กัน deadlock ระหว่าง batch ที่มีไฟล์ชุดเดียวกัน
+	sorted := slices.Clone(objects)
+	slices.SortFunc(sorted, func(a, b storedObject) int { return strings.Compare(a.Hash, b.Hash) })
+	sorted = slices.CompactFunc(sorted, func(a, b storedObject) bool { return a.Hash == b.Hash })
+
+	for _, o := range sorted {
+		if err := database.LockContentHash(tx, o.Hash); err != nil {
+			return err
+		}
+		exists, err := storage.Default.Exists(ctx, o.Key)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			if err := storage.Default.Put(ctx, o.Key, bytes.NewReader(o.data), int64(len(o.data)), o.contentType); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// releaseImageObjects deletes keys, the objects stored for hash, once no
+// committed row references the hash.
+func releaseImageObjects(ctx context.Context, hash string, keys []string) {
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := database.LockContentHash(tx, hash); err != nil {
+			return err
+		}
+
+		var refs int64
+		if err := tx.Model(&models.ProductImage{}).
+			Where("content_hash = ?", hash).
+			Count(&refs).Error; err != nil || refs > 0 {
+			return err
+		}
+
+		for _, key := range keys {
+			if err := storage.Default.Delete(ctx, key); err != nil {
+				log.Printf("⚠️ Failed to delete object %s: %v", key, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("⚠️ Failed to release objects for %s: %v", hash, err)
+	}
+}
+
+// discardStoredObjects removes objects that storeProductImage wrote for
+// images that were then not saved. Objects that were already stored, or
+// that an image row has referenced since, are left alone. It runs on its
+// own context so a cancelled request still cleans up.
+func discardStoredObjects(objects ...storedObject) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for _, o := range objects {
+		if o.Created {
+			releaseImageObjects(ctx, o.Hash, []string{o.Key})
+		}
+	}
+}
+
+// MigrateInlineProductImages moves images still stored as base64 data URIs
+// in product_images.url into storage.
+func MigrateInlineProductImages() {
+	var images []models.ProductImage
+	if err := database.DB.Where("url LIKE ?", "data:%").Find(&images).Error; err != nil {
+		log.Printf("⚠️ Product image migration skipped: %v", err)
+		return
+	}
+
+	ctx := context.Background()
+	migrated := 0
+	for _, image := range images {
+		data, err := decodeDataURI(image.URL)
+		if err != nil {
+			log.Printf("⚠️ Product image %s is not a valid data URI: %v", image.ID, err)
+			continue
+		}
+
+		normalized, err := imaging.Normalize(data)
+		if err != nil {
+			log.Printf("⚠️ Product image %s is not an image, leaving it as is", image.ID)
+			continue
+		}
+
+		object, err := storeProductImage(ctx, normalized)
+		if err != nil {
+			log.Printf("⚠️ Failed to store product image %s: %v", image.ID, err)
+			continue
+		}
+
+		err = database.DB.Transaction(func(tx *gorm.DB) error {
+			if err := ensureStoredObjects(ctx, tx, object); err != nil {
+				return err
+			}
+			return tx.Model(&image).Updates(object.columns()).Error
+		})
+		if err != nil {
+			log.Printf("⚠️ Failed to update product image %s: %v", image.ID, err)
+			discardStoredObjects(object)
+			continue
+		}
+		migrated++
+	}
+
+	if migrated > 0 {
+		log.Printf("✅ Migrated %d inline product images", migrated)
+	}
+}
+
+// NormalizeStoredProductImages runs imaging.Normalize over originals that
+// were stored before uploads were normalized, so their EXIF data (GPS
+// position, camera serial) is no longer served. The normalized file gets a
+// new content hash and key; the row moves to it, its variants are dropped
+// for the image worker to regenerate, and the old files are removed once
+// nothing references them. Avatars need no pass: they have always been
+// re-encoded on upload.
+func NormalizeStoredProductImages() {
+	var images []models.ProductImage
+	if err := database.DB.
+		Where("object_key <> '' AND normalized_at IS NULL").
+		Find(&images).Error; err != nil {
+		log.Printf("⚠️ Product image normalization skipped: %v", err)
+		return
+	}
+
+	ctx := context.Background()
+	normalized := 0
+	for _, image := range images {
+		r, err := storage.Default.Get(ctx, image.ObjectKey)
+		if err != nil {
+			log.Printf("⚠️ Failed to read product image %s: %v", image.ID, err)
+			continue
+		}
+		data, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			log.Printf("⚠️ Failed to read product image %s: %v", image.ID, err)
+			continue
+		}
+
+		n, err := imaging.Normalize(data)
+		if err != nil {
+			log.Printf("⚠️ Product image %s could not be normalized: %v", image.ID, err)
+			continue
+		}
+
+		object, err := storeProductImage(ctx, n)
+		if err != nil {
+			log.Printf("⚠️ Failed to store product image %s: %v", image.ID, err)
+			continue
+		}
+
+		previous := image
+		var variants []models.ProductImageVariant
+		err = database.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Clauses(clause.Returning{}).
+				Where("image_id = ?", image.ID).
+				Delete(&variants).Error; err != nil {
+				return err
+			}
+			if err := ensureStoredObjects(ctx, tx, object); err != nil {
+				return err
+			}
+			return tx.Model(&image).Updates(object.columns()).Error
+		})
+		if err != nil {
+			log.Printf("⚠️ Failed to update product image %s: %v", image.ID, err)
+			discardStoredObjects(object)
+			continue
+		}
+
+		if previous.ObjectKey != object.Key {
+			deleteImageObjects(ctx, &previous, variants)
+		}
+		normalized++
+	}
+
+	if normalized > 0 {
+		log.Printf("✅ Normalized %d stored product images", normalized)
+	}
+}
+
+// UpdateProductImage changes an image's alt text.
+func UpdateProductImage(c *fiber.Ctx) error {
+	type Input struct {
+		Alt *string `json:"alt"`
+	}
+
+	var input Input
+	if err := c.BodyParser(&input); err != nil || input.Alt == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":    false,
+			"error": "alt is required",
+		})
+	}
+
+	image, err := findProductImage(c)
+	if image == nil {
+		return err
+	}
+
+	alt := strings.TrimSpace(*input.Alt)
+	image.Alt = &alt
+	if alt == "" {
+		image.Alt = nil
+	}
+
+	if err := database.DB.Model(image).Update("alt", image.Alt).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Failed to update image",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"ok":    true,
+		"image": image,
+	})
+}
+
+// DeleteProductImage removes an image, closes the gap in positions and
+// deletes its stored files unless another image uses the same content.
+func DeleteProductImage(c *fiber.Ctx) error {
+	image, err := findProductImage(c)
+	if image == nil {
+		return err
+	}
+
+	var variants []models.ProductImageVariant
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var product models.Product
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&product, "id = ?", image.ProductID).Error; err != nil {
+			return err
+		}
+
+		// รอ image worker ที่กำลังเขียน variant ของรูปนี้อยู่ให้เสร็จก่อน
+		// จะได้ลบ variant ที่มันเพิ่งบันทึกไปด้วย
+		if err := database.LockContentHash(tx, image.ContentHash); err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Returning{}).
+			Where("image_id = ?", image.ID).
+			Delete(&variants).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(image).Error; err != nil {
+			return err
+		}
+
+		var remaining []uuid.UUID
+		if err := tx.Model(&models.ProductImage{}).
+			Where("product_id = ?", image.ProductID).
+			Order("position").
+			Pluck("id", &remaining).Error; err != nil {
+			return err
+		}
+		return setImagePositions(tx, image.ProductID, remaining)
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Failed to delete image",
+		})
+	}
+
+	deleteImageObjects(c.UserContext(), image, variants)
+
+	return c.JSON(fiber.Map{
+		"ok":      true,
+		"message": "Image deleted",
+	})
+}
+
+// ReorderProductImages takes every image ID of the product in the new
+// order and applies it in one transaction.
+func ReorderProductImages(c *fiber.Ctx) error {
+	productUUID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Invalid product ID format",
+		})
+	}
+
+	type Input struct {
+		ImageIDs []uuid.UUID `json:"imageIds"`
+	}
+
+	var input Input
+	if err := c.BodyParser(&input); err != nil || len(input.ImageIDs) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":    false,
+			"error": "imageIds must be a list of image IDs",
+		})
+	}
+
+	errMismatch := errors.New("image list mismatch")
+	productID := productUUID.String()
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var product models.Product
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&product, "id = ?", productUUID).Error; err != nil {
+			return err
+		}
+
+		var current []uuid.UUID
+		if err := tx.Model(&models.ProductImage{}).
+			Where("product_id = ?", productID).
+			Pluck("id", &current).Error; err != nil {
+			return err
+		}
+
+		// ต้องส่งรูปของสินค้านี้มาครบทุกรูป ไม่ซ้ำ ไม่เกิน
+		seen := make(map[uuid.UUID]bool, len(current))
+		for _, id := range current {
+			seen[id] = false
+		}
+		for _, id := range input.ImageIDs {
+			used, ok := seen[id]
+			if !ok || used {
+				return errMismatch
+			}
+			seen[id] = true
+		}
+		if len(input.ImageIDs) != len(current) {
+			return errMismatch
+		}
+
+		return setImagePositions(tx, productID, input.ImageIDs)
+	})
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Product not found",
+		})
+	case errors.Is(err, errMismatch):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":    false,
+			"error": "imageIds must list every image of the product exactly once",
+		})
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Failed to reorder images",
+		})
+	}
+
+	var images []models.ProductImage
+	database.DB.Preload("Variants").
+		Where("product_id = ?", productID).
+		Order("position").
+		Find(&images)
+	useServedImageURLs(images)
+
+	return c.JSON(fiber.Map{
+		"ok":     true,
+		"images": images,
+	})
+}
+
+// findProductImage loads :imageId and checks it belongs to product :id.
+// When it returns nil the error response has already been written.
+func findProductImage(c *fiber.Ctx) (*models.ProductImage, error) {
+	productUUID, err1 := uuid.Parse(c.Params("id"))
+	imageUUID, err2 := uuid.Parse(c.Params("imageId"))
+	if err1 != nil || err2 != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Invalid ID format",
+		})
+	}
+
+	var image models.ProductImage
+	if err := database.DB.
+		First(&image, "id = ? AND product_id = ?", imageUUID, productUUID.String()).Error; err != nil {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Image not found",
+		})
+	}
+
+	return &image, nil
+}
+
+// setImagePositions numbers ids 1..n. Positions are first moved out of
+// the way (negated) so the unique (product_id, position) index holds after
+// every statement.
+func setImagePositions(tx *gorm.DB, productID string, ids []uuid.UUID) error {
+	if err := tx.Model(&models.ProductImage{}).
+		Where("product_id = ?", productID).
+		Update("position", gorm.Expr("-position - 1")).Error; err != nil {
+		return err
+	}
+
+	for i, id := range ids {
+		if err := tx.Model(&models.ProductImage{}).
+			Where("id = ?", id).
+			Update("position", i+1).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteImageObjects removes the files behind an image whose row is gone
+// or points elsewhere now. Keys are derived from the content hash, so they
+// are kept while any other image still has the same content.
+func deleteImageObjects(ctx context.Context, image *models.ProductImage, variants []models.ProductImageVariant) {
+	if image.ObjectKey == "" {
+		return
+	}
+
+	keys := []string{image.ObjectKey}
+	for _, v := range variants {
+		keys = append(keys, v.ObjectKey)
+	}
+	releaseImageObjects(ctx, image.ContentHash, keys)
+}
+
+// maxNearDuplicateDistance bounds ?distance: each extra bit adds a band,
+// and narrower bands match more unrelated pairs.
+const maxNearDuplicateDistance = 10
+
+// NearDuplicateImages lists pairs of images whose perceptual hashes differ
+// in at most ?distance bits (default 6), usually the same photo uploaded
+// again after resizing or re-compression.
+//
+// Comparing every pair is quadratic, so the hash is split into distance+1
+// bands. Two hashes within distance bits cannot differ in every band, so
+// only pairs that share at least one band exactly are compared.
+func NearDuplicateImages(c *fiber.Ctx) error {
+	distance := c.QueryInt("distance", 6)
+	if distance < 0 || distance > maxNearDuplicateDistance {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":    false,
+			"error": fmt.Sprintf("distance must be between 0 and %d", maxNearDuplicateDistance),
+		})
+	}
+	bands := distance + 1
+
+	type pair struct {
+		ImageID          uuid.UUID `json:"imageId"`
+		ProductID        string    `json:"productId"`
+		ProductName      string    `json:"productName"`
+		OtherImageID     uuid.UUID `json:"otherImageId"`
+		OtherProductID   string    `json:"otherProductId"`
+		OtherProductName string    `json:"otherProductName"`
+		Distance         int       `json:"distance"`
+		Identical        bool      `json:"identical"`
+	}
+
+	var pairs []pair
+	if err := database.DB.Raw(`
+		WITH bands AS (
+			-- แถบสุดท้ายเก็บบิตที่เหลือทั้งหมด ไม่ต้อง mask
+			SELECT i.id, band,
+				CASE WHEN band = @bands - 1 THEN i.perceptual_hash >> (band * @width)
+					ELSE (i.perceptual_hash >> (band * @width)) & ((1::bigint << @width) - 1)
+				END AS value
+			FROM product_images i, generate_series(0, @bands - 1) AS band
+			WHERE i.perceptual_hash IS NOT NULL
+		),
+		candidates AS (
+			SELECT DISTINCT a.id AS a_id, b.id AS b_id
+			FROM bands a
+			JOIN bands b ON a.band = b.band AND a.value = b.value AND a.id < b.id
+		)
+		SELECT * FROM (
+			SELECT a.id AS image_id, a.product_id, pa.name AS product_name,
+				b.id AS other_image_id, b.product_id AS other_product_id, pb.name AS other_product_name,
+				length(replace(((a.perceptual_hash # b.perceptual_hash)::bit(64))::text, '0', '')) AS distance,
+				a.content_hash = b.content_hash AS identical
+			FROM candidates
+			JOIN product_images a ON a.id = candidates.a_id
+			JOIN product_images b ON b.id = candidates.b_id
+			JOIN products pa ON pa.id::text = a.product_id
+			JOIN products pb ON pb.id::text = b.product_id
+		) AS compared
+		WHERE distance <= @distance
+		ORDER BY distance, product_id
+		LIMIT 500`,
+		map[string]interface{}{
+			"bands":    bands,
+			"width":    64 / bands,
+			"distance": distance,
+		}).Scan(&pairs).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Failed to build duplicate report",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"ok":    true,
+		"pairs": pairs,
 	})
 }
@@ -1,7 +1,9 @@
 package controllers
 
 import (
+	"review-products/auth"
 	"review-products/database"
+	"review-products/middleware"
 	"review-products/models"
 
 	"github.com/gofiber/fiber/v2"
@@ -11,7 +13,6 @@ import (
 func CreateReview(c *fiber.Ctx) error {
 	type Input struct {
 		ProductID string `json:"productID"`
-		UserID    string `json:"userID"`
 		Title     string `json:"title"`
 		Body      string `json:"body"`
 		Rating    int    `json:"rating"`
@@ -31,12 +32,6 @@ func CreateReview(c *fiber.Ctx) error {
 		})
 	}
 
-	if input.UserID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "UserID is required",
-		})
-	}
-
 	if input.Rating < 1 || input.Rating > 5 {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Rating must be between 1 and 5",
@@ -55,15 +50,12 @@ func CreateReview(c *fiber.Ctx) error {
 		})
 	}
 
-	if _, err := uuid.Parse(input.UserID); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid UserID format",
-		})
-	}
+	// ผู้เขียนรีวิวมาจาก token เสมอ
+	user := middleware.CurrentUser(c)
 
 	review := models.Review{
 		ProductID: input.ProductID,
-		UserID:    input.UserID,
+		UserID:    user.ID.String(),
 		Title:     &input.Title,
 		Body:      input.Body,
 		Rating:    input.Rating,
@@ -167,6 +159,10 @@ func UpdateReview(c *fiber.Ctx) error {
 		})
 	}
 
+	if !canModifyReview(c, review, auth.PermReviewUpdateAny) {
+		return middleware.Forbidden(c, "You can only edit your own reviews")
+	}
+
 	type Input struct {
 		Title  *string `json:"title"`
 		Body   *string `json:"body"`
@@ -236,6 +232,10 @@ func DeleteReview(c *fiber.Ctx) error {
 		})
 	}
 
+	if !canModifyReview(c, review, auth.PermReviewDeleteAny) {
+		return middleware.Forbidden(c, "You can only delete your own reviews")
+	}
+
 	if err := database.DB.Delete(&review).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"ok":    false,
@@ -248,3 +248,14 @@ func DeleteReview(c *fiber.Ctx) error {
 		"message": "Review deleted successfully",
 	})
 }
+
+// canModifyReview allows the author, or anyone whose role grants override
+// (moderators and admins by default).
+func canModifyReview(c *fiber.Ctx, review models.Review, override auth.Permission) bool {
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		return false
+	}
+
+	return review.UserID == user.ID.String() || middleware.HasPermission(c, override)
+}
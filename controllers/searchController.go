@@ -0,0 +1,206 @@
+package controllers
+
+import (
+	"log"
+	"review-products/database"
+	"review-products/models"
+	"review-products/search"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// minNameSimilarity is the pg_trgm word_similarity a product name needs
+// to count as a fuzzy match, which is what catches typos. It is set as
+// pg_trgm.word_similarity_threshold for the <% operator.
+const minNameSimilarity = 0.4
+
+// SearchProducts handles /api/products/search?q=. A product matches when
+// its SKU equals q, when its name or description contains every word of q
+// (see package search), or, when pg_trgm is available, when its name is
+// close to q. SKU matches rank first, then full-text rank and name
+// similarity.
+func SearchProducts(c *fiber.Ctx) error {
+	q := strings.TrimSpace(c.Query("q"))
+	tsquery := search.Query(q)
+	if tsquery == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":    false,
+			"error": "q must contain letters or digits",
+		})
+	}
+
+	limit := c.QueryInt("limit", 20)
+	offset := c.QueryInt("offset", 0)
+	if limit < 1 || limit > 50 || offset < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":    false,
+			"error": "limit must be between 1 and 50 and offset not negative",
+		})
+	}
+
+	type hit struct {
+		ID    uuid.UUID
+		Score float64
+		Match string
+	}
+
+	// ไม่มี pg_trgm ก็ค้นด้วย full-text อย่างเดียว
+	nameScore, nameMatch := "0", "false"
+	if database.Trigram {
+		nameScore = "word_similarity(query.q, lower(products.name))"
+		nameMatch = "query.q <% lower(products.name)"
+	}
+	with := `
+		WITH query AS (
+			SELECT to_tsquery('simple', @tsquery) AS tsq, lower(@q) AS q
+		)`
+	from := `
+		FROM products, query
+		WHERE lower(products.sku) = query.q
+			OR products.search_vector @@ query.tsq
+			OR ` + nameMatch
+	params := map[string]interface{}{
+		"tsquery": tsquery,
+		"q":       q,
+		"limit":   limit,
+		"offset":  offset,
+	}
+
+	var hits []hit
+	var total int64
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if database.Trigram {
+			// <% matches against this threshold and, unlike comparing
+			// word_similarity() directly, can use idx_products_name_trgm.
+			if err := tx.Exec("SELECT set_config('pg_trgm.word_similarity_threshold', ?, true)",
+				strconv.FormatFloat(minNameSimilarity, 'f', -1, 64)).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Raw(with+" SELECT COUNT(*)"+from, params).Scan(&total).Error; err != nil {
+			return err
+		}
+		if total == 0 {
+			return nil
+		}
+
+		return tx.Raw(with+`
+		SELECT products.id,
+			(CASE WHEN lower(products.sku) = query.q THEN 10 ELSE 0 END)
+				+ ts_rank_cd(products.search_vector, query.tsq)
+				+ `+nameScore+` AS score,
+			CASE
+				WHEN lower(products.sku) = query.q THEN 'sku'
+				WHEN products.search_vector @@ query.tsq THEN 'text'
+				ELSE 'fuzzy'
+			END AS match`+from+`
+		ORDER BY score DESC, products.id
+		LIMIT @limit OFFSET @offset`, params).Scan(&hits).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Search failed",
+		})
+	}
+
+	ids := make([]uuid.UUID, len(hits))
+	for i, h := range hits {
+		ids[i] = h.ID
+	}
+
+	var products []models.Product
+	if len(ids) > 0 {
+		if err := database.DB.
+			Preload("Images", func(db *gorm.DB) *gorm.DB { return db.Order("position") }).
+			Preload("Images.Variants").
+			Find(&products, "id IN ?", ids).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"ok":    false,
+				"error": "Search failed",
+			})
+		}
+	}
+
+	byID := make(map[uuid.UUID]*models.Product, len(products))
+	for i := range products {
+		useServedImageURLs(products[i].Images)
+		byID[products[i].ID] = &products[i]
+	}
+
+	results := make([]fiber.Map, 0, len(hits))
+	for _, h := range hits {
+		product, ok := byID[h.ID]
+		if !ok {
+			continue
+		}
+
+		description := ""
+		if product.Description != nil {
+			description = *product.Description
+		}
+
+		results = append(results, fiber.Map{
+			"product": product,
+			"score":   h.Score,
+			"match":   h.Match,
+			"highlight": fiber.Map{
+				"name":        search.Highlight(product.Name, q, 0),
+				"description": search.Highlight(description, q, 160),
+			},
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"ok":      true,
+		"query":   q,
+		"results": results,
+		"total":   total,
+	})
+}
+
+// indexProduct refreshes the product's search vector. The name weighs
+// more than the description in ranking.
+func indexProduct(db *gorm.DB, product *models.Product) error {
+	description := ""
+	if product.Description != nil {
+		description = *product.Description
+	}
+
+	return db.Exec(`
+		UPDATE products SET search_vector =
+			setweight(to_tsvector('simple', ?), 'A') || setweight(to_tsvector('simple', ?), 'B')
+		WHERE id = ?`,
+		search.Document(product.Name), search.Document(description), product.ID).Error
+}
+
+// ReindexProducts builds search vectors for products that have none yet,
+// e.g. those created before search existed.
+func ReindexProducts() {
+	var products []models.Product
+	indexed := 0
+
+	err := database.DB.Where("search_vector IS NULL").
+		FindInBatches(&products, 200, func(tx *gorm.DB, batch int) error {
+			for i := range products {
+				if err := indexProduct(database.DB, &products[i]); err != nil {
+					return err
+				}
+				indexed++
+			}
+			return nil
+		}).Error
+	if err != nil {
+		log.Printf("⚠️ Product search indexing failed: %v", err)
+		return
+	}
+
+	if indexed > 0 {
+		log.Printf("✅ Indexed %d products for search", indexed)
+	}
+}
@@ -1,12 +1,32 @@
 package controllers
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
 	"review-products/database"
+	"review-products/imaging"
+	"review-products/middleware"
 	"review-products/models"
+	"review-products/storage"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 )
 
+const maxAvatarBytes = 5 * 1024 * 1024
+
+// avatarSizes are the square sizes stored for every avatar; User.Avatar
+// points at the largest one.
+var avatarSizes = []int{64, 128, 256}
+
 func GetUser(c *fiber.Ctx) error {
 	id := c.Params("ID")
 	var user models.User
@@ -19,3 +39,190 @@ func GetUser(c *fiber.Ctx) error {
 
 	return c.JSON(user)
 }
+
+func UploadAvatar(c *fiber.Ctx) error {
+	user := middleware.CurrentUser(c)
+
+	file, err := c.FormFile("avatar")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":    false,
+			"error": "avatar file is required",
+		})
+	}
+
+	if file.Size > maxAvatarBytes {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Avatar must be 5MB or smaller",
+		})
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Could not read avatar",
+		})
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, maxAvatarBytes+1))
+	if err != nil || len(data) > maxAvatarBytes {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Could not read avatar",
+		})
+	}
+
+	urls, key, err := storeAvatar(c.UserContext(), user.ID, data)
+	switch {
+	case errors.Is(err, imaging.ErrNotImage), errors.Is(err, imaging.ErrImageTooLarge):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":    false,
+			"error": err.Error(),
+		})
+	case err != nil:
+		log.Printf("Failed to store avatar for %s: %v", user.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Failed to save avatar",
+		})
+	}
+
+	oldKey := user.AvatarKey
+	avatarURL := urls[avatarSizes[len(avatarSizes)-1]]
+	if err := database.DB.Model(user).Updates(map[string]interface{}{
+		"avatar":     avatarURL,
+		"avatar_key": key,
+	}).Error; err != nil {
+		if oldKey == nil || *oldKey != key {
+			deleteAvatar(c.UserContext(), key)
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"ok":    false,
+			"error": "Failed to save avatar",
+		})
+	}
+
+	if oldKey != nil && *oldKey != key {
+		deleteAvatar(c.UserContext(), *oldKey)
+	}
+
+	return c.JSON(fiber.Map{
+		"ok":      true,
+		"message": "Avatar updated successfully",
+		"avatar":  avatarURL,
+		"sizes":   urls,
+	})
+}
+
+// storeAvatar validates data, resizes it to every avatar size and stores
+// the JPEGs under avatars/<user>/<hash>-<size>.jpg. It returns the URL per
+// size and the key prefix used to delete them later. Sizes that already
+// exist are the same file and are kept; when a size fails, the ones this
+// call wrote are deleted again.
+func storeAvatar(ctx context.Context, userID uuid.UUID, data []byte) (urls map[int]string, key string, err error) {
+	img, err := imaging.Decode(data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	sum := sha256.Sum256(data)
+	key = fmt.Sprintf("avatars/%s/%s", userID, hex.EncodeToString(sum[:8]))
+
+	var written []string
+	defer func() {
+		if err != nil {
+			for _, objectKey := range written {
+				if err := storage.Default.Delete(context.Background(), objectKey); err != nil {
+					log.Printf("Failed to delete avatar object %s: %v", objectKey, err)
+				}
+			}
+		}
+	}()
+
+	urls = make(map[int]string, len(avatarSizes))
+	for _, size := range avatarSizes {
+		objectKey := avatarObjectKey(key, size)
+		urls[size] = storage.Default.URL(objectKey)
+
+		exists, err := storage.Default.Exists(ctx, objectKey)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to check avatar: %w", err)
+		}
+		if exists {
+			continue
+		}
+
+		out, err := imaging.EncodeJPEG(imaging.Square(img, size), 85)
+		if err != nil {
+			return nil, "", err
+		}
+		if err := storage.Default.Put(ctx, objectKey, bytes.NewReader(out), int64(len(out)), "image/jpeg"); err != nil {
+			return nil, "", fmt.Errorf("failed to store avatar: %w", err)
+		}
+		written = append(written, objectKey)
+	}
+
+	return urls, key, nil
+}
+
+func avatarObjectKey(key string, size int) string {
+	return fmt.Sprintf("%s-%d.jpg", key, size)
+}
+
+func deleteAvatar(ctx context.Context, key string) {
+	for _, size := range avatarSizes {
+		if err := storage.Default.Delete(ctx, avatarObjectKey(key, size)); err != nil {
+			log.Printf("Failed to delete avatar object %s: %v", key, err)
+		}
+	}
+}
+
+// MigrateInlineAvatars moves avatars still stored as base64 data URIs into
+// storage. Data that is not a usable image (the old default pointed at an
+// HTML page) is cleared.
+func MigrateInlineAvatars() {
+	var users []models.User
+	if err := database.DB.Where("avatar LIKE ?", "data:%").Find(&users).Error; err != nil {
+		log.Printf("⚠️ Avatar migration skipped: %v", err)
+		return
+	}
+
+	for _, user := range users {
+		var update map[string]interface{}
+
+		data, err := decodeDataURI(*user.Avatar)
+		if err == nil {
+			var urls map[int]string
+			var key string
+			urls, key, err = storeAvatar(context.Background(), user.ID, data)
+			if err == nil {
+				update = map[string]interface{}{
+					"avatar":     urls[avatarSizes[len(avatarSizes)-1]],
+					"avatar_key": key,
+				}
+			}
+		}
+		if err != nil {
+			update = map[string]interface{}{"avatar": nil, "avatar_key": nil}
+		}
+
+		if err := database.DB.Model(&user).Updates(update).Error; err != nil {
+			log.Printf("⚠️ Avatar migration failed for %s: %v", user.ID, err)
+		}
+	}
+
+	if len(users) > 0 {
+		log.Printf("✅ Migrated %d inline avatars", len(users))
+	}
+}
+
+func decodeDataURI(uri string) ([]byte, error) {
+	_, payload, found := strings.Cut(uri, ";base64,")
+	if !found {
+		return nil, fmt.Errorf("not a base64 data URI")
+	}
+	return base64.StdEncoding.DecodeString(payload)
+}
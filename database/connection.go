@@ -13,6 +13,10 @@ import (
 
 var DB *gorm.DB
 
+// Trigram reports whether pg_trgm is available. Without it product search
+// only uses full-text matching, so typos no longer find anything.
+var Trigram bool
+
 func init() {
 	if err := godotenv.Load(); err != nil {
 		log.Println("⚠️ No .env file found, using system env")
@@ -31,7 +35,10 @@ func Connect() {
 	)
 
 	var err error
-	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{
+		// unique violations come back as gorm.ErrDuplicatedKey
+		TranslateError: true,
+	})
 	if err != nil {
 		log.Fatalf("Failed to connect database: %v", err)
 	}
@@ -41,13 +48,86 @@ func Connect() {
 }
 
 func autoMigrate() {
+	renumberImagePositions()
+	backfillVerified := !DB.Migrator().HasColumn(&models.User{}, "EmailVerifiedAt")
+
 	err := DB.AutoMigrate(
 		&models.User{},
+		&models.Category{},
 		&models.Product{},
 		&models.ProductImage{},
+		&models.ProductImageVariant{},
 		&models.Review{},
+		&models.RefreshToken{},
+		&models.PasswordResetToken{},
+		&models.RecoveryCode{},
+		&models.LoginThrottle{},
+		&models.UserIdentity{},
+		&models.OAuthState{},
+		&models.APIKey{},
 	)
 	if err != nil {
 		log.Fatalf("❌ Auto migration failed: %v", err)
 	}
+
+	if backfillVerified {
+		verifyExistingUsers()
+	}
+	searchIndexes()
+}
+
+// verifyExistingUsers marks users created before email verification
+// existed as verified, so REQUIRE_VERIFIED_EMAIL does not lock them out.
+func verifyExistingUsers() {
+	result := DB.Model(&models.User{}).
+		Where("email_verified_at IS NULL").
+		Update("email_verified_at", gorm.Expr("created_at"))
+	if result.Error != nil {
+		log.Fatalf("❌ Failed to backfill email_verified_at: %v", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("✅ Marked %d existing users as verified", result.RowsAffected)
+	}
+}
+
+// searchIndexes adds the indexes product search needs that AutoMigrate
+// cannot express. pg_trgm is a trusted extension, so the database owner
+// can enable it without superuser rights; when that still fails, search
+// runs without fuzzy name matching and Trigram stays false.
+func searchIndexes() {
+	if err := DB.Exec(`CREATE INDEX IF NOT EXISTS idx_products_sku_lower ON products (lower(sku))`).Error; err != nil {
+		log.Printf("⚠️ Search index setup failed: %v", err)
+	}
+
+	statements := []string{
+		`CREATE EXTENSION IF NOT EXISTS pg_trgm`,
+		`CREATE INDEX IF NOT EXISTS idx_products_name_trgm ON products USING gin (lower(name) gin_trgm_ops)`,
+	}
+	for _, statement := range statements {
+		if err := DB.Exec(statement).Error; err != nil {
+			log.Printf("⚠️ pg_trgm setup failed, search falls back to full-text only: %v", err)
+			return
+		}
+	}
+	Trigram = true
+}
+
+// renumberImagePositions gives each product's images positions 1..n before
+// the unique (product_id, position) index is created, since older uploads
+// could end up sharing a position.
+func renumberImagePositions() {
+	if !DB.Migrator().HasTable(&models.ProductImage{}) {
+		return
+	}
+
+	err := DB.Exec(`
+		UPDATE product_images SET position = ranked.rn
+		FROM (
+			SELECT id, ROW_NUMBER() OVER (PARTITION BY product_id ORDER BY position, id) AS rn
+			FROM product_images
+		) AS ranked
+		WHERE product_images.id = ranked.id AND product_images.position IS DISTINCT FROM ranked.rn`).Error
+	if err != nil {
+		log.Fatalf("❌ Failed to renumber product image positions: %v", err)
+	}
 }
@@ -0,0 +1,11 @@
+package database
+
+import "gorm.io/gorm"
+
+// LockContentHash holds a transaction-scoped advisory lock on an image
+// content hash. Everything that writes or deletes the objects stored for a
+// hash, or adds rows that reference them, takes it first, so the reference
+// count a deleter reads cannot change before it deletes.
+func LockContentHash(tx *gorm.DB, hash string) error {
+	return tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", hash).Error
+}
@@ -0,0 +1,246 @@
+package fetcher
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"review-products/imaging"
+)
+
+var (
+	ErrDisallowedURL  = errors.New("URL is not allowed")
+	ErrBlockedAddress = errors.New("URL resolves to a blocked address")
+	ErrTooLarge       = errors.New("remote file is too large")
+	ErrNotImage       = errors.New("remote file is not an image")
+)
+
+// Fetcher downloads remote images on behalf of users without letting them
+// reach internal services (SSRF). The destination IP is checked when the
+// connection is made, after DNS resolution, so a hostname that re-resolves
+// to a private address between checks (DNS rebinding) is still refused.
+type Fetcher struct {
+	MaxBytes       int64
+	AllowedDomains []string
+
+	client *http.Client
+
+	// allowDial exempts "ip:port" addresses from the dial check. Tests use
+	// it to reach an httptest server, which always listens on loopback.
+	allowDial func(address string) bool
+}
+
+type Config struct {
+	Timeout        time.Duration
+	MaxBytes       int64
+	MaxRedirects   int
+	AllowedDomains []string
+}
+
+var Default *Fetcher
+
+// Init configures Default from env:
+//
+//	IMAGE_FETCH_TIMEOUT          total request timeout (default 10s)
+//	IMAGE_FETCH_MAX_BYTES        size cap (default 10MB)
+//	IMAGE_FETCH_MAX_REDIRECTS    default 3
+//	IMAGE_FETCH_ALLOWED_DOMAINS  comma separated; empty allows any public host
+func Init() {
+	cfg := Config{
+		Timeout:      10 * time.Second,
+		MaxBytes:     10 * 1024 * 1024,
+		MaxRedirects: 3,
+	}
+
+	if d, err := time.ParseDuration(os.Getenv("IMAGE_FETCH_TIMEOUT")); err == nil && d > 0 {
+		cfg.Timeout = d
+	}
+	if n, err := strconv.ParseInt(os.Getenv("IMAGE_FETCH_MAX_BYTES"), 10, 64); err == nil && n > 0 {
+		cfg.MaxBytes = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("IMAGE_FETCH_MAX_REDIRECTS")); err == nil && n >= 0 {
+		cfg.MaxRedirects = n
+	}
+	for _, domain := range strings.Split(os.Getenv("IMAGE_FETCH_ALLOWED_DOMAINS"), ",") {
+		if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+			cfg.AllowedDomains = append(cfg.AllowedDomains, domain)
+		}
+	}
+
+	Default = New(cfg)
+	log.Println("✅ Image fetcher ready")
+}
+
+func New(cfg Config) *Fetcher {
+	f := &Fetcher{
+		MaxBytes:       cfg.MaxBytes,
+		AllowedDomains: cfg.AllowedDomains,
+	}
+
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			if f.allowDial != nil && f.allowDial(address) {
+				return nil
+			}
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			addr, err := netip.ParseAddr(host)
+			if err != nil || isBlocked(addr) {
+				return ErrBlockedAddress
+			}
+			return nil
+		},
+	}
+
+	transport := &http.Transport{
+		// ไม่ใช้ proxy จาก env เพราะจะข้ามการตรวจ IP ตอน dial
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: cfg.Timeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       30 * time.Second,
+	}
+
+	f.client = &http.Client{
+		Timeout:   cfg.Timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > cfg.MaxRedirects {
+				return fmt.Errorf("stopped after %d redirects", cfg.MaxRedirects)
+			}
+			return f.checkURL(req.URL)
+		},
+	}
+
+	return f
+}
+
+// FetchImage downloads rawURL and returns its bytes with the content type
+// sniffed from the data; the remote Content-Type header is not trusted.
+func (f *Fetcher) FetchImage(ctx context.Context, rawURL string) ([]byte, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, "", ErrDisallowedURL
+	}
+	if err := f.checkURL(u); err != nil {
+		return nil, "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Accept", "image/*")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		if errors.Is(err, ErrBlockedAddress) {
+			return nil, "", ErrBlockedAddress
+		}
+		if errors.Is(err, ErrDisallowedURL) {
+			return nil, "", ErrDisallowedURL
+		}
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("remote server returned %s", resp.Status)
+	}
+	if resp.ContentLength > f.MaxBytes {
+		return nil, "", ErrTooLarge
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, f.MaxBytes+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if int64(len(data)) > f.MaxBytes {
+		return nil, "", ErrTooLarge
+	}
+
+	contentType, err := imaging.Sniff(data)
+	if err != nil {
+		return nil, "", ErrNotImage
+	}
+	if _, _, err := image.DecodeConfig(bytes.NewReader(data)); err != nil {
+		return nil, "", ErrNotImage
+	}
+
+	return data, contentType, nil
+}
+
+// checkURL enforces the scheme allow-list, rejects credentials and IP
+// literals that are blocked, and applies the domain allow-list.
+func (f *Fetcher) checkURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ErrDisallowedURL
+	}
+	if u.User != nil || u.Hostname() == "" {
+		return ErrDisallowedURL
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if addr, err := netip.ParseAddr(host); err == nil && isBlocked(addr) {
+		return ErrBlockedAddress
+	}
+
+	if len(f.AllowedDomains) == 0 {
+		return nil
+	}
+	for _, domain := range f.AllowedDomains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return nil
+		}
+	}
+	return ErrDisallowedURL
+}
+
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("2001:db8::/32"),
+}
+
+// isBlocked covers loopback, private, link-local (incl. cloud metadata at
+// 169.254.169.254), multicast and other non-public ranges.
+func isBlocked(addr netip.Addr) bool {
+	addr = addr.Unmap()
+
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return true
+	}
+
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,335 @@
+package imageworker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"review-products/database"
+	"review-products/imaging"
+	"review-products/models"
+	"review-products/storage"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Variant describes one resized rendition generated for every image. The
+// image is scaled to fit inside a MaxSize×MaxSize box.
+type Variant struct {
+	Name    string
+	MaxSize int
+}
+
+var Variants = []Variant{
+	{Name: "thumbnail", MaxSize: 160},
+	{Name: "card", MaxSize: 480},
+	{Name: "full", MaxSize: 1200},
+}
+
+// variantsVersion changes whenever Variants or the encodings change, so
+// images processed with an older set are queued again.
+const variantsVersion = 2
+
+// maxVariantFailures is how many times an image may fail processing before
+// the startup sweep stops queueing it.
+const maxVariantFailures = 3
+
+var queue chan uuid.UUID
+
+// Start launches IMAGE_WORKERS (default 2) goroutines that generate
+// variants, then queues every image processed with an older variant set
+// or missing its perceptual hash, dimensions or placeholder. Uploads only
+// enqueue, so they return without waiting for resizing.
+func Start() {
+	workers, err := strconv.Atoi(os.Getenv("IMAGE_WORKERS"))
+	if err != nil || workers <= 0 {
+		workers = 2
+	}
+
+	queue = make(chan uuid.UUID, 1000)
+	for i := 0; i < workers; i++ {
+		go run()
+	}
+
+	go enqueueMissing()
+	log.Printf("✅ Image worker started with %d workers", workers)
+}
+
+// Enqueue schedules variant generation. When the queue is full the image
+// is skipped and picked up by the sweep on next start.
+func Enqueue(imageID uuid.UUID) {
+	if queue == nil {
+		return
+	}
+
+	select {
+	case queue <- imageID:
+	default:
+		log.Printf("⚠️ Image queue full, variants for %s postponed", imageID)
+	}
+}
+
+func enqueueMissing() {
+	var ids []uuid.UUID
+	if err := database.DB.Model(&models.ProductImage{}).
+		Where("object_key <> '' AND variant_failures < ?", maxVariantFailures).
+		Where("perceptual_hash IS NULL OR width = 0 OR blur_hash IS NULL OR blur_hash = '' OR variants_version < ?", variantsVersion).
+		Pluck("id", &ids).Error; err != nil {
+		log.Printf("⚠️ Failed to find images without variants: %v", err)
+		return
+	}
+
+	for _, id := range ids {
+		queue <- id
+	}
+}
+
+func run() {
+	for id := range queue {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		err := Process(ctx, id)
+		cancel()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// รูปถูกลบไปแล้ว ไม่มีอะไรต้องทำ
+			continue
+		}
+
+		// นับจำนวนครั้งที่ล้มเหลว รูปที่เสียถาวรจะได้ไม่ถูกคิวซ้ำทุกครั้งที่ start
+		failures := gorm.Expr("0")
+		if err != nil {
+			log.Printf("⚠️ Failed to generate variants for %s: %v", id, err)
+			failures = gorm.Expr("variant_failures + 1")
+		}
+		if err := database.DB.Model(&models.ProductImage{}).Where("id = ?", id).
+			Update("variant_failures", failures).Error; err != nil {
+			log.Printf("⚠️ Failed to record variant status for %s: %v", id, err)
+		}
+	}
+}
+
+// Process generates every variant of the image as JPEG, plus a lossless
+// WebP when that comes out smaller, and records them. Running it again for
+// the same image is harmless.
+//
+// Variant objects are shared by images with the same content, so they are
+// written and recorded in one transaction under database.LockContentHash,
+// the lock deleters take. An image deleted in the meantime is left alone
+// and Process returns gorm.ErrRecordNotFound.
+func Process(ctx context.Context, imageID uuid.UUID) error {
+	var image models.ProductImage
+	if err := database.DB.First(&image, "id = ?", imageID).Error; err != nil {
+		return err
+	}
+	if image.ObjectKey == "" {
+		return fmt.Errorf("image has no stored object")
+	}
+
+	r, err := storage.Default.Get(ctx, image.ObjectKey)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		return err
+	}
+
+	src, err := imaging.Decode(data)
+	if err != nil {
+		return err
+	}
+
+	variants, err := encodeVariants(src, image.ObjectKey)
+	if err != nil {
+		return err
+	}
+
+	var written, dropped []string
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := database.LockContentHash(tx, image.ContentHash); err != nil {
+			return err
+		}
+		// รูปอาจถูกลบหรือเปลี่ยนไฟล์ไประหว่างย่อขนาด
+		objectKey := image.ObjectKey
+		if err := tx.First(&image, "id = ?", imageID).Error; err != nil {
+			return err
+		}
+		if image.ObjectKey != objectKey {
+			return fmt.Errorf("image was replaced while processing")
+		}
+
+		for _, v := range variants {
+			if v.data == nil {
+				removed, err := dropVariant(tx, image.ID, v)
+				if err != nil {
+					return err
+				}
+				if removed {
+					dropped = append(dropped, v.key)
+				}
+				continue
+			}
+
+			created, err := saveVariant(ctx, tx, image.ID, v)
+			if created {
+				written = append(written, v.key)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		updates := map[string]interface{}{"variants_version": variantsVersion}
+		// รูปที่อัปโหลดก่อนมี perceptual hash / ขนาดรูป / placeholder
+		if image.PerceptualHash == nil || image.Width == 0 || image.BlurHash == "" {
+			updates["perceptual_hash"] = int64(imaging.DHash(src))
+			updates["width"] = src.Bounds().Dx()
+			updates["height"] = src.Bounds().Dy()
+			updates["blur_hash"] = imaging.BlurHash(src)
+			updates["dominant_color"] = imaging.DominantColor(src)
+		}
+		return tx.Model(&image).Updates(updates).Error
+	})
+	if err != nil {
+		releaseVariantObjects(image.ContentHash, written)
+		return err
+	}
+
+	releaseVariantObjects(image.ContentHash, dropped)
+	return nil
+}
+
+// encodedVariant is one size in one format, ready to store. data is nil
+// when the format is not kept for that size.
+type encodedVariant struct {
+	name, format, key string
+	width, height     int
+	data              []byte
+}
+
+func encodeVariants(src image.Image, objectKey string) ([]encodedVariant, error) {
+	base := strings.TrimSuffix(objectKey, "."+extension(objectKey))
+
+	var out []encodedVariant
+	for _, v := range Variants {
+		resized := imaging.Fit(src, v.MaxSize, v.MaxSize)
+		b := resized.Bounds()
+
+		jpegData, err := imaging.EncodeJPEG(resized, 82)
+		if err != nil {
+			return nil, err
+		}
+
+		// WebP แบบ lossless มักใหญ่กว่า JPEG สำหรับรูปถ่าย เก็บไว้เฉพาะตอนที่เล็กกว่า
+		webpData, err := imaging.EncodeWebP(resized)
+		if err != nil {
+			return nil, err
+		}
+		if len(webpData) >= len(jpegData) {
+			webpData = nil
+		}
+
+		out = append(out,
+			encodedVariant{v.Name, "jpeg", base + "-" + v.Name + ".jpg", b.Dx(), b.Dy(), jpegData},
+			encodedVariant{v.Name, "webp", base + "-" + v.Name + ".webp", b.Dx(), b.Dy(), webpData},
+		)
+	}
+	return out, nil
+}
+
+// FormatContentTypes maps each generated variant format to its content type.
+var FormatContentTypes = map[string]string{
+	"jpeg": "image/jpeg",
+	"webp": "image/webp",
+}
+
+// saveVariant stores v and upserts its row. The object is written even when
+// another image with the same content already has it, since an older
+// variant set may have left different content under the key. created
+// reports whether the object is new, so a failed transaction knows what
+// to remove.
+func saveVariant(ctx context.Context, tx *gorm.DB, imageID uuid.UUID, v encodedVariant) (created bool, err error) {
+	exists, err := storage.Default.Exists(ctx, v.key)
+	if err != nil {
+		return false, err
+	}
+	if err := storage.Default.Put(ctx, v.key, bytes.NewReader(v.data), int64(len(v.data)), FormatContentTypes[v.format]); err != nil {
+		return !exists, err
+	}
+
+	variant := models.ProductImageVariant{
+		ImageID:   imageID,
+		Name:      v.name,
+		Format:    v.format,
+		Width:     v.width,
+		Height:    v.height,
+		Size:      int64(len(v.data)),
+		ObjectKey: v.key,
+		URL:       storage.Default.URL(v.key),
+	}
+	return !exists, tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "image_id"}, {Name: "name"}, {Name: "format"}},
+		DoUpdates: clause.AssignmentColumns([]string{"width", "height", "size", "object_key", "url"}),
+	}).Create(&variant).Error
+}
+
+// dropVariant deletes the row of a variant that is no longer generated for
+// the image. Its object is released after the transaction commits.
+func dropVariant(tx *gorm.DB, imageID uuid.UUID, v encodedVariant) (bool, error) {
+	result := tx.Where("image_id = ? AND name = ? AND format = ?", imageID, v.name, v.format).
+		Delete(&models.ProductImageVariant{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// releaseVariantObjects deletes variant objects of hash that no variant row
+// references, under the same lock Process writes them with.
+func releaseVariantObjects(hash string, keys []string) {
+	if len(keys) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := database.LockContentHash(tx, hash); err != nil {
+			return err
+		}
+
+		for _, key := range keys {
+			var refs int64
+			if err := tx.Model(&models.ProductImageVariant{}).
+				Where("object_key = ?", key).
+				Count(&refs).Error; err != nil {
+				return err
+			}
+			if refs > 0 {
+				continue
+			}
+			if err := storage.Default.Delete(ctx, key); err != nil {
+				log.Printf("⚠️ Failed to delete variant object %s: %v", key, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("⚠️ Failed to release variant objects for %s: %v", hash, err)
+	}
+}
+
+func extension(key string) string {
+	if i := strings.LastIndex(key, "."); i >= 0 {
+		return key[i+1:]
+	}
+	return ""
+}
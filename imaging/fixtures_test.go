@@ -0,0 +1,130 @@
+//go:build fixtures
+
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image/jpeg"
+	"os"
+	"testing"
+)
+
+// TestGenerateFixtures rewrites testdata/orientation-<n>.jpg:
+//
+//	go test -tags fixtures -run TestGenerateFixtures ./imaging
+//
+// Each file stores the pixels laid out as storedLayouts describes, plus GPS
+// and serial-number tags.
+func TestGenerateFixtures(t *testing.T) {
+	for o := 1; o <= 8; o++ {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, storedFixture(o), &jpeg.Options{Quality: 95}); err != nil {
+			t.Fatal(err)
+		}
+		raw := buf.Bytes()
+
+		app1 := exifSegment(uint16(o))
+		data := append(append(append([]byte{}, raw[:2]...), app1...), raw[2:]...)
+
+		path := fmt.Sprintf("testdata/orientation-%d.jpg", o)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+type tiffEntry struct {
+	tag, typ uint16
+	count    uint32
+	data     []byte
+}
+
+func ascii(s string) tiffEntry {
+	return tiffEntry{typ: 2, count: uint32(len(s) + 1), data: append([]byte(s), 0)}
+}
+
+func rationals(values ...uint32) tiffEntry {
+	data := make([]byte, 0, len(values)*8)
+	for _, v := range values {
+		data = binary.LittleEndian.AppendUint32(data, v)
+		data = binary.LittleEndian.AppendUint32(data, 1)
+	}
+	return tiffEntry{typ: 5, count: uint32(len(values)), data: data}
+}
+
+func short(v uint16) tiffEntry {
+	return tiffEntry{typ: 3, count: 1, data: binary.LittleEndian.AppendUint16(nil, v)}
+}
+
+func long(v uint32) tiffEntry {
+	return tiffEntry{typ: 4, count: 1, data: binary.LittleEndian.AppendUint32(nil, v)}
+}
+
+func tagged(tag uint16, e tiffEntry) tiffEntry {
+	e.tag = tag
+	return e
+}
+
+// ifd serializes entries placed at offset, with values longer than four
+// bytes stored right after the directory.
+func ifd(entries []tiffEntry, offset int) []byte {
+	size := 2 + 12*len(entries) + 4
+	var dir, extra []byte
+	dir = binary.LittleEndian.AppendUint16(dir, uint16(len(entries)))
+	for _, e := range entries {
+		dir = binary.LittleEndian.AppendUint16(dir, e.tag)
+		dir = binary.LittleEndian.AppendUint16(dir, e.typ)
+		dir = binary.LittleEndian.AppendUint32(dir, e.count)
+		if len(e.data) <= 4 {
+			value := make([]byte, 4)
+			copy(value, e.data)
+			dir = append(dir, value...)
+			continue
+		}
+		dir = binary.LittleEndian.AppendUint32(dir, uint32(offset+size+len(extra)))
+		extra = append(extra, e.data...)
+		if len(extra)%2 == 1 {
+			extra = append(extra, 0)
+		}
+	}
+	dir = binary.LittleEndian.AppendUint32(dir, 0)
+	return append(dir, extra...)
+}
+
+func exifSegment(orientation uint16) []byte {
+	exifIFD := []tiffEntry{
+		tagged(0xA431, ascii("SN-0042-FIXTURE")), // BodySerialNumber
+	}
+	gpsIFD := []tiffEntry{
+		tagged(0x0001, ascii("N")),
+		tagged(0x0002, rationals(13, 45, 7)),
+		tagged(0x0003, ascii("E")),
+		tagged(0x0004, rationals(100, 31, 12)),
+	}
+	ifd0 := func(exifAt, gpsAt int) []tiffEntry {
+		return []tiffEntry{
+			tagged(0x010F, ascii("FixtureCam")),
+			tagged(0x0112, short(orientation)),
+			tagged(0x8769, long(uint32(exifAt))),
+			tagged(0x8825, long(uint32(gpsAt))),
+		}
+	}
+
+	ifd0Size := len(ifd(ifd0(0, 0), 8))
+	exifAt := 8 + ifd0Size
+	exifBytes := ifd(exifIFD, exifAt)
+	gpsAt := exifAt + len(exifBytes)
+
+	tiff := []byte("II*\x00")
+	tiff = binary.LittleEndian.AppendUint32(tiff, 8)
+	tiff = append(tiff, ifd(ifd0(exifAt, gpsAt), 8)...)
+	tiff = append(tiff, exifBytes...)
+	tiff = append(tiff, ifd(gpsIFD, gpsAt)...)
+
+	body := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xFF, 0xE1}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(body)+2))
+	return append(segment, body...)
+}
@@ -0,0 +1,190 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	"github.com/HugoSmits86/nativewebp"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// maxPixels guards against decompression bombs: a tiny file that claims
+// huge dimensions is rejected before any pixels are allocated.
+const maxPixels = 40_000_000
+
+var (
+	ErrNotImage      = errors.New("file is not a supported image")
+	ErrImageTooLarge = errors.New("image dimensions are too large")
+)
+
+var allowedTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// Sniff detects the content type from the file's magic bytes, ignoring
+// whatever the client or remote server claimed.
+func Sniff(data []byte) (string, error) {
+	contentType := http.DetectContentType(data)
+	if !allowedTypes[contentType] {
+		return "", ErrNotImage
+	}
+	return contentType, nil
+}
+
+// Decode sniffs and decodes data, refusing non-images and oversized images.
+// JPEGs and WebPs are turned upright according to their EXIF orientation.
+func Decode(data []byte) (image.Image, error) {
+	if _, err := Sniff(data); err != nil {
+		return nil, err
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrNotImage
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxPixels {
+		return nil, ErrImageTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrNotImage
+	}
+	return orient(img, exifOrientation(data)), nil
+}
+
+// Normalized is an upload after Normalize.
+type Normalized struct {
+	Data        []byte
+	ContentType string
+	Image       image.Image
+}
+
+// Normalize decodes data, applies EXIF orientation and re-encodes it so no
+// metadata (GPS position, camera serials, comments) survives. JPEGs are
+// re-encoded as JPEG; PNG and GIF become PNG, keeping only the first GIF
+// frame. WebP files are not re-encoded, since there is no lossy WebP
+// encoder available: their EXIF and XMP chunks are dropped instead. Only
+// a WebP whose EXIF orientation is not upright is re-encoded, as lossless
+// WebP, because its pixels have to be turned.
+func Normalize(data []byte) (Normalized, error) {
+	contentType, err := Sniff(data)
+	if err != nil {
+		return Normalized{}, err
+	}
+
+	img, err := Decode(data)
+	if err != nil {
+		return Normalized{}, err
+	}
+
+	var out []byte
+	switch contentType {
+	case "image/jpeg":
+		out, err = EncodeJPEG(img, 90)
+	case "image/webp":
+		if exifOrientation(data) > 1 {
+			out, err = EncodeWebP(img)
+		} else {
+			out, err = stripWebPMetadata(data)
+		}
+	default:
+		contentType = "image/png"
+		var buf bytes.Buffer
+		err = png.Encode(&buf, img)
+		out = buf.Bytes()
+	}
+	if err != nil {
+		return Normalized{}, err
+	}
+
+	return Normalized{Data: out, ContentType: contentType, Image: img}, nil
+}
+
+// Square center-crops img and scales it to size×size.
+func Square(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	side := min(b.Dx(), b.Dy())
+	x0 := b.Min.X + (b.Dx()-side)/2
+	y0 := b.Min.Y + (b.Dy()-side)/2
+	crop := image.Rect(x0, y0, x0+side, y0+side)
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, crop, draw.Src, nil)
+	return dst
+}
+
+// Fit scales img down to fit inside maxWidth×maxHeight, keeping the aspect
+// ratio. Images that are already small enough are returned as is.
+func Fit(img image.Image, maxWidth, maxHeight int) image.Image {
+	b := img.Bounds()
+	if b.Dx() <= maxWidth && b.Dy() <= maxHeight {
+		return img
+	}
+
+	width, height := maxWidth, b.Dy()*maxWidth/b.Dx()
+	if height > maxHeight {
+		width, height = b.Dx()*maxHeight/b.Dy(), maxHeight
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, max(1, width), max(1, height)))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+// EncodeWebP encodes img as lossless WebP. For photos this is usually
+// larger than a JPEG, so callers compare sizes before using it.
+func EncodeWebP(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := nativewebp.Encode(&buf, img, nil); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// EncodeJPEG re-encodes img. Go's encoder writes no metadata.
+func EncodeJPEG(img image.Image, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, flatten(img), &jpeg.Options{Quality: quality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// flatten draws img onto white so transparent PNG/GIF areas do not turn
+// black in JPEG output.
+func flatten(img image.Image) image.Image {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Over)
+	return dst
+}
+
+// DHash is a 64-bit difference hash: img is shrunk to 9×8 grayscale and
+// each bit records whether a pixel is brighter than its right neighbour.
+// Resized or re-encoded copies of a photo differ in only a few bits.
+func DHash(img image.Image) uint64 {
+	src := flatten(img)
+	small := image.NewGray(image.Rect(0, 0, 9, 8))
+	draw.ApproxBiLinear.Scale(small, small.Bounds(), src, src.Bounds(), draw.Src, nil)
+
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if small.GrayAt(x, y).Y > small.GrayAt(x+1, y).Y {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
@@ -0,0 +1,353 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"os"
+	"strings"
+	"testing"
+)
+
+// fixtureImage is 48×24: red top-left and green top-right squares on blue.
+func fixtureImage() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 48, 24))
+	for y := 0; y < 24; y++ {
+		for x := 0; x < 48; x++ {
+			c := color.RGBA{0, 0, 255, 255}
+			switch {
+			case x < 12 && y < 12:
+				c = color.RGBA{255, 0, 0, 255}
+			case x >= 36 && y < 12:
+				c = color.RGBA{0, 255, 0, 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+// storedLayouts describes, per EXIF orientation, how a camera stores
+// fixtureImage: the stored size and the corners holding the red and green
+// squares. It is written out from the spec ("row 0 is the visual top/
+// bottom/left/right, column 0 is the visual ...") rather than computed,
+// so fixtures do not depend on orient.
+var storedLayouts = map[int]struct {
+	w, h       int
+	red, green string
+}{
+	1: {48, 24, "top-left", "top-right"},
+	2: {48, 24, "top-right", "top-left"},
+	3: {48, 24, "bottom-right", "bottom-left"},
+	4: {48, 24, "bottom-left", "bottom-right"},
+	5: {24, 48, "top-left", "bottom-left"},
+	6: {24, 48, "bottom-left", "top-left"},
+	7: {24, 48, "bottom-right", "top-right"},
+	8: {24, 48, "top-right", "bottom-right"},
+}
+
+// storedFixture paints fixtureImage as stored for orientation.
+func storedFixture(orientation int) image.Image {
+	l := storedLayouts[orientation]
+	img := image.NewRGBA(image.Rect(0, 0, l.w, l.h))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.RGBA{0, 0, 255, 255}), image.Point{}, draw.Src)
+
+	square := func(corner string, c color.RGBA) {
+		x, y := 0, 0
+		if strings.HasSuffix(corner, "right") {
+			x = l.w - 12
+		}
+		if strings.HasPrefix(corner, "bottom") {
+			y = l.h - 12
+		}
+		draw.Draw(img, image.Rect(x, y, x+12, y+12), image.NewUniform(c), image.Point{}, draw.Src)
+	}
+	square(l.red, color.RGBA{255, 0, 0, 255})
+	square(l.green, color.RGBA{0, 255, 0, 255})
+	return img
+}
+
+// checkUpright expects img to be fixtureImage.
+func checkUpright(t *testing.T, img image.Image) {
+	t.Helper()
+
+	if b := img.Bounds(); b.Dx() != 48 || b.Dy() != 24 {
+		t.Fatalf("size = %dx%d, want 48x24", b.Dx(), b.Dy())
+	}
+	want := map[image.Point]string{
+		{5, 5}:   "red",
+		{42, 5}:  "green",
+		{5, 18}:  "blue",
+		{42, 18}: "blue",
+	}
+	for p, color := range want {
+		if got := dominantChannel(img, p.X, p.Y); got != color {
+			t.Errorf("pixel %v is %s, want %s", p, got, color)
+		}
+	}
+}
+
+// dominantChannel reports which of r, g, b is strongest at (x, y).
+func dominantChannel(img image.Image, x, y int) string {
+	r, g, b, _ := img.At(x, y).RGBA()
+	switch {
+	case r > g && r > b:
+		return "red"
+	case g > r && g > b:
+		return "green"
+	default:
+		return "blue"
+	}
+}
+
+// jpegSegments lists the markers before the image data.
+func jpegSegments(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var markers []byte
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			t.Fatalf("bad marker at %d", i)
+		}
+		marker := data[i+1]
+		if marker == 0xDA {
+			break
+		}
+		markers = append(markers, marker)
+		i += 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+	}
+	return markers
+}
+
+func TestNormalizeJPEGOrientationAndMetadata(t *testing.T) {
+	for o := 1; o <= 8; o++ {
+		t.Run(fmt.Sprintf("orientation-%d", o), func(t *testing.T) {
+			data, err := os.ReadFile(fmt.Sprintf("testdata/orientation-%d.jpg", o))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if exifOrientation(data) != o {
+				t.Fatalf("fixture orientation = %d, want %d", exifOrientation(data), o)
+			}
+			if !bytes.Contains(data, []byte("SN-0042-FIXTURE")) {
+				t.Fatal("fixture is missing its serial number tag")
+			}
+
+			n, err := Normalize(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n.ContentType != "image/jpeg" {
+				t.Fatalf("content type = %s", n.ContentType)
+			}
+
+			// ตรวจว่า fixture เก็บพิกเซลตาม storedLayouts จริง ไม่ได้สร้างจาก orient
+			stored, err := jpeg.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			l := storedLayouts[o]
+			if b := stored.Bounds(); b.Dx() != l.w || b.Dy() != l.h {
+				t.Fatalf("fixture size = %dx%d, want %dx%d", b.Dx(), b.Dy(), l.w, l.h)
+			}
+			corners := map[string]image.Point{
+				"top-left":     {5, 5},
+				"top-right":    {l.w - 6, 5},
+				"bottom-left":  {5, l.h - 6},
+				"bottom-right": {l.w - 6, l.h - 6},
+			}
+			for corner, p := range corners {
+				want := "blue"
+				switch corner {
+				case l.red:
+					want = "red"
+				case l.green:
+					want = "green"
+				}
+				if got := dominantChannel(stored, p.X, p.Y); got != want {
+					t.Errorf("fixture %s is %s, want %s", corner, got, want)
+				}
+			}
+
+			out, err := jpeg.Decode(bytes.NewReader(n.Data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkUpright(t, out)
+			checkUpright(t, n.Image)
+
+			for _, marker := range jpegSegments(t, n.Data) {
+				if marker == 0xE1 {
+					t.Error("output still has an APP1 segment")
+				}
+			}
+			for _, leak := range []string{"Exif", "SN-0042-FIXTURE", "FixtureCam"} {
+				if bytes.Contains(n.Data, []byte(leak)) {
+					t.Errorf("output still contains %q", leak)
+				}
+			}
+		})
+	}
+}
+
+func TestNormalizeWebPDropsMetadataChunks(t *testing.T) {
+	// metadata.webp is a lossless 48×24 WebP with a VP8X header
+	// announcing EXIF and XMP chunks that carry GPS data and a serial.
+	data, err := os.ReadFile("testdata/metadata.webp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := Normalize(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.ContentType != "image/webp" {
+		t.Fatalf("content type = %s", n.ContentType)
+	}
+
+	for _, leak := range []string{"EXIF", "XMP ", "SN-0042-FIXTURE", "exif:GPSLatitude"} {
+		if bytes.Contains(n.Data, []byte(leak)) {
+			t.Errorf("output still contains %q", leak)
+		}
+	}
+	if got := binary.LittleEndian.Uint32(n.Data[4:]); int(got) != len(n.Data)-8 {
+		t.Errorf("RIFF size = %d, want %d", got, len(n.Data)-8)
+	}
+	if flags := n.Data[20]; flags&(vp8xFlagEXIF|vp8xFlagXMP) != 0 {
+		t.Errorf("VP8X flags = %#x, metadata bits still set", flags)
+	}
+
+	out, err := Decode(n.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := out.Bounds(); b.Dx() != 48 || b.Dy() != 24 {
+		t.Fatalf("size = %dx%d, want 48x24", b.Dx(), b.Dy())
+	}
+	if got := dominantChannel(out, 5, 5); got != "red" {
+		t.Errorf("top-left pixel is %s, want red", got)
+	}
+}
+
+func TestFitBoundsBothDimensions(t *testing.T) {
+	tests := []struct {
+		w, h, maxW, maxH int
+		wantW, wantH     int
+	}{
+		{4000, 1000, 1200, 1200, 1200, 300},
+		{1000, 4000, 1200, 1200, 300, 1200},
+		{800, 600, 1200, 1200, 800, 600},
+		{5000, 10, 160, 160, 160, 1},
+	}
+	for _, tt := range tests {
+		img := image.NewRGBA(image.Rect(0, 0, tt.w, tt.h))
+		b := Fit(img, tt.maxW, tt.maxH).Bounds()
+		if b.Dx() != tt.wantW || b.Dy() != tt.wantH {
+			t.Errorf("Fit(%dx%d, %d, %d) = %dx%d, want %dx%d",
+				tt.w, tt.h, tt.maxW, tt.maxH, b.Dx(), b.Dy(), tt.wantW, tt.wantH)
+		}
+	}
+}
+
+func TestEncodeWebPRoundTrip(t *testing.T) {
+	data, err := EncodeWebP(fixtureImage())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 48 || b.Dy() != 24 {
+		t.Fatalf("size = %dx%d, want 48x24", b.Dx(), b.Dy())
+	}
+	if got := dominantChannel(img, 5, 5); got != "red" {
+		t.Errorf("top-left pixel is %s, want red", got)
+	}
+	if got := dominantChannel(img, 42, 5); got != "green" {
+		t.Errorf("top-right pixel is %s, want green", got)
+	}
+
+	// ภาพสีเรียบแบบนี้ lossless WebP ควรเล็กกว่า JPEG ซึ่งเป็นกรณีที่ worker เก็บไว้
+	jpegData, err := EncodeJPEG(fixtureImage(), 82)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) >= len(jpegData) {
+		t.Errorf("WebP is %d bytes, JPEG %d; expected WebP to be smaller for flat colours", len(data), len(jpegData))
+	}
+}
+
+// orientedWebP wraps a lossless WebP of the stored fixture in a VP8X
+// container with an EXIF chunk holding only the Orientation tag.
+func orientedWebP(t *testing.T, orientation int) []byte {
+	t.Helper()
+
+	encoded, err := EncodeWebP(storedFixture(orientation))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tiff := []byte("II*\x00")
+	tiff = binary.LittleEndian.AppendUint32(tiff, 8)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint16(tiff, orientationTag)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 3) // SHORT
+	tiff = binary.LittleEndian.AppendUint32(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint32(tiff, uint32(orientation))
+	tiff = binary.LittleEndian.AppendUint32(tiff, 0)
+
+	l := storedLayouts[orientation]
+	vp8x := []byte{vp8xFlagEXIF, 0, 0, 0}
+	vp8x = append(vp8x, byte(l.w-1), byte((l.w-1)>>8), byte((l.w-1)>>16))
+	vp8x = append(vp8x, byte(l.h-1), byte((l.h-1)>>8), byte((l.h-1)>>16))
+
+	chunk := func(fourCC string, payload []byte) []byte {
+		out := append([]byte(fourCC), binary.LittleEndian.AppendUint32(nil, uint32(len(payload)))...)
+		out = append(out, payload...)
+		if len(payload)%2 == 1 {
+			out = append(out, 0)
+		}
+		return out
+	}
+
+	body := []byte("WEBP")
+	body = append(body, chunk("VP8X", vp8x)...)
+	body = append(body, encoded[12:]...) // the VP8L chunk
+	body = append(body, chunk("EXIF", tiff)...)
+	return append(append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...), body...)
+}
+
+func TestNormalizeWebPAppliesOrientation(t *testing.T) {
+	for o := 1; o <= 8; o++ {
+		t.Run(fmt.Sprintf("orientation-%d", o), func(t *testing.T) {
+			data := orientedWebP(t, o)
+			if got := exifOrientation(data); got != o {
+				t.Fatalf("fixture orientation = %d, want %d", got, o)
+			}
+
+			n, err := Normalize(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n.ContentType != "image/webp" {
+				t.Fatalf("content type = %s", n.ContentType)
+			}
+			if bytes.Contains(n.Data, []byte("EXIF")) {
+				t.Error("output still has an EXIF chunk")
+			}
+
+			out, err := Decode(n.Data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkUpright(t, out)
+			checkUpright(t, n.Image)
+		})
+	}
+}
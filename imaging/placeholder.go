@@ -0,0 +1,156 @@
+package imaging
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+const base83Chars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// BlurHash encodes img as a BlurHash (https://blurha.sh) with 4×3
+// components, which clients decode into a blurred placeholder.
+func BlurHash(img image.Image) string {
+	const cx, cy = 4, 3
+
+	// ใช้รูปเล็กก็พอ ผลแทบไม่ต่างแต่เร็วกว่ามาก
+	small := thumbnailRGBA(img, 32)
+	w, h := small.Bounds().Dx(), small.Bounds().Dy()
+
+	factors := make([][3]float64, 0, cx*cy)
+	for j := 0; j < cy; j++ {
+		for i := 0; i < cx; i++ {
+			var f [3]float64
+			for y := 0; y < h; y++ {
+				for x := 0; x < w; x++ {
+					basis := math.Cos(math.Pi*float64(i*x)/float64(w)) * math.Cos(math.Pi*float64(j*y)/float64(h))
+					p := small.Pix[small.PixOffset(x, y):]
+					f[0] += basis * srgbToLinear(p[0])
+					f[1] += basis * srgbToLinear(p[1])
+					f[2] += basis * srgbToLinear(p[2])
+				}
+			}
+
+			scale := 2.0 / float64(w*h)
+			if i == 0 && j == 0 {
+				scale = 1.0 / float64(w*h)
+			}
+			factors = append(factors, [3]float64{f[0] * scale, f[1] * scale, f[2] * scale})
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString(base83((cx-1)+(cy-1)*9, 1))
+
+	maximum := 0.0
+	for _, f := range factors[1:] {
+		for _, v := range f {
+			maximum = math.Max(maximum, math.Abs(v))
+		}
+	}
+	quantisedMax := int(math.Max(0, math.Min(82, math.Floor(maximum*166-0.5))))
+	maximum = float64(quantisedMax+1) / 166
+	sb.WriteString(base83(quantisedMax, 1))
+
+	dc := factors[0]
+	sb.WriteString(base83(linearToSRGB(dc[0])<<16|linearToSRGB(dc[1])<<8|linearToSRGB(dc[2]), 4))
+
+	for _, f := range factors[1:] {
+		var q [3]int
+		for k, v := range f {
+			q[k] = int(math.Max(0, math.Min(18, math.Floor(signPow(v/maximum, 0.5)*9+9.5))))
+		}
+		sb.WriteString(base83(q[0]*19*19+q[1]*19+q[2], 2))
+	}
+
+	return sb.String()
+}
+
+// DominantColor returns the most common color of img as "#rrggbb",
+// averaged within a coarse 4-bit-per-channel bucket.
+func DominantColor(img image.Image) string {
+	small := thumbnailRGBA(img, 64)
+
+	type bucket struct {
+		count   int
+		r, g, b int
+	}
+	buckets := make(map[int]*bucket)
+	var best *bucket
+
+	for i := 0; i+3 < len(small.Pix); i += 4 {
+		r, g, b := int(small.Pix[i]), int(small.Pix[i+1]), int(small.Pix[i+2])
+		key := (r>>4)<<8 | (g>>4)<<4 | b>>4
+
+		bk := buckets[key]
+		if bk == nil {
+			bk = &bucket{}
+			buckets[key] = bk
+		}
+		bk.count++
+		bk.r += r
+		bk.g += g
+		bk.b += b
+
+		if best == nil || bk.count > best.count {
+			best = bk
+		}
+	}
+
+	if best == nil {
+		return "#ffffff"
+	}
+	return fmt.Sprintf("#%02x%02x%02x", best.r/best.count, best.g/best.count, best.b/best.count)
+}
+
+// thumbnailRGBA flattens img onto white and scales it so its longer side
+// is at most size.
+func thumbnailRGBA(img image.Image, size int) *image.RGBA {
+	src := flatten(img)
+	b := src.Bounds()
+
+	w, h := b.Dx(), b.Dy()
+	if w > size || h > size {
+		if w >= h {
+			w, h = size, max(1, h*size/w)
+		} else {
+			w, h = max(1, w*size/h), size
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.ApproxBiLinear.Scale(dst, dst.Bounds(), src, b, draw.Src, nil)
+	return dst
+}
+
+func base83(value, length int) string {
+	out := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		out[i] = base83Chars[value%83]
+		value /= 83
+	}
+	return string(out)
+}
+
+func srgbToLinear(v uint8) float64 {
+	c := float64(v) / 255
+	if c <= 0.04045 {
+		return c / 12.92
+	}
+	return math.Pow((c+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(v float64) int {
+	v = math.Max(0, math.Min(1, v))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(v, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(v), exp), v)
+}
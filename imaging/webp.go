@@ -0,0 +1,78 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// VP8X flag bits announcing EXIF and XMP chunks.
+const (
+	vp8xFlagEXIF = 0x08
+	vp8xFlagXMP  = 0x04
+)
+
+func isWebP(data []byte) bool {
+	return len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WEBP"
+}
+
+// webpOrientation reads the Orientation tag from a WebP EXIF chunk.
+func webpOrientation(data []byte) int {
+	for i := 12; i+8 <= len(data); {
+		size := int(binary.LittleEndian.Uint32(data[i+4:]))
+		end := i + 8 + size
+		if end > len(data) {
+			return 1
+		}
+		if string(data[i:i+4]) == "EXIF" {
+			// บาง encoder ยังใส่ "Exif\0\0" นำหน้าแบบ JPEG
+			return tiffOrientation(bytes.TrimPrefix(data[i+8:end], []byte("Exif\x00\x00")))
+		}
+		i = end + size%2
+	}
+	return 1
+}
+
+// stripWebPMetadata removes the EXIF and XMP chunks from a WebP file and
+// clears their flags in the VP8X header. The image data is copied as is,
+// so a lossy photo stays lossy and keeps its size.
+func stripWebPMetadata(data []byte) ([]byte, error) {
+	if !isWebP(data) {
+		return nil, ErrNotImage
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:12])
+
+	for i := 12; i < len(data); {
+		if i+8 > len(data) {
+			return nil, ErrNotImage
+		}
+		fourCC := string(data[i : i+4])
+		size := int(binary.LittleEndian.Uint32(data[i+4:]))
+		end := i + 8 + size + size%2
+		if end > len(data) {
+			// บาง encoder ไม่เติม padding ท้ายไฟล์
+			if i+8+size != len(data) {
+				return nil, ErrNotImage
+			}
+			end = len(data)
+		}
+
+		switch fourCC {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := append([]byte(nil), data[i:end]...)
+			if size > 0 {
+				chunk[8] &^= vp8xFlagEXIF | vp8xFlagXMP
+			}
+			out.Write(chunk)
+		default:
+			out.Write(data[i:end])
+		}
+		i = end
+	}
+
+	result := out.Bytes()
+	binary.LittleEndian.PutUint32(result[4:], uint32(len(result)-8))
+	return result, nil
+}
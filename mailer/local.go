@@ -0,0 +1,32 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// LogSender prints messages to the application log, for local development.
+type LogSender struct{}
+
+func (LogSender) Send(msg Message) error {
+	log.Printf("📧 To: %s | Subject: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// FileSender writes every message to its own .eml file in Dir, so tests
+// and local tooling can pick up links from the mail body.
+type FileSender struct {
+	Dir string
+}
+
+func (s FileSender) Send(msg Message) error {
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), filepath.Base(msg.To))
+	return os.WriteFile(filepath.Join(s.Dir, name), format("noreply@localhost", msg), 0o644)
+}
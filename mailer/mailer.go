@@ -0,0 +1,57 @@
+package mailer
+
+import (
+	"log"
+	"os"
+	"strconv"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers a single plain-text message.
+type Sender interface {
+	Send(msg Message) error
+}
+
+var Default Sender = LogSender{}
+
+// Init picks the sender from MAIL_DRIVER: "smtp", "file" or "log". There
+// is no default: "log" prints reset and verification links to stdout,
+// which must not happen in production by accident.
+func Init() {
+	switch os.Getenv("MAIL_DRIVER") {
+	case "smtp":
+		port, err := strconv.Atoi(os.Getenv("SMTP_PORT"))
+		if err != nil {
+			port = 587
+		}
+		Default = SMTPSender{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("MAIL_FROM"),
+		}
+	case "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "tmp/mail"
+		}
+		Default = FileSender{Dir: dir}
+	case "log":
+		Default = LogSender{}
+	case "":
+		log.Fatal(`❌ MAIL_DRIVER is not set: use "smtp" in production, or "log" or "file" for local development`)
+	default:
+		log.Fatalf("❌ Unknown MAIL_DRIVER %q", os.Getenv("MAIL_DRIVER"))
+	}
+}
+
+// Send delivers msg through the configured sender.
+func Send(msg Message) error {
+	return Default.Send(msg)
+}
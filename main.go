@@ -3,15 +3,25 @@ package main
 import (
 	"log"
 	"os"
+	"review-products/auth"
+	"review-products/controllers"
 	"review-products/database"
+	"review-products/fetcher"
+	"review-products/imageworker"
+	"review-products/mailer"
+	"review-products/oidc"
 	"review-products/routers"
+	"review-products/storage"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/joho/godotenv"
 )
 
 func main() {
-	app := fiber.New()
+	app := fiber.New(fiber.Config{
+		// รองรับการอัปโหลดรูปหลายไฟล์ต่อ request
+		BodyLimit: 20 * 1024 * 1024,
+	})
 
 	err := godotenv.Load()
 	if err != nil {
@@ -19,12 +29,28 @@ func main() {
 	}
 
 	database.Connect()
+	auth.BootstrapAdmin()
+	auth.InitKeyring()
+	mailer.Init()
+	oidc.Init()
+	storage.Init()
+	fetcher.Init()
+	controllers.MigrateInlineAvatars()
+	controllers.MigrateInlineProductImages()
+	controllers.NormalizeStoredProductImages()
+	controllers.ReindexProducts()
+	imageworker.Start()
+
+	routers.StorageRoutes(app)
 
 	routers.AuthRoutes(app)
 	routers.UserRouter(app)
 	routers.ProductRoutes(app)
+	routers.CategoryRoutes(app)
 	routers.ProductImageRoutes(app)
 	routers.ReviewRouters(app)
+	routers.AdminRoutes(app)
+	routers.APIKeyRoutes(app)
 
 	// ดึง SERVER_PORT จาก env
 	port := os.Getenv("SERVER_PORT")
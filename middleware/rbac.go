@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"review-products/auth"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequirePermission must run after RequireAuth or RequireScopedAuth.
+// Callers whose role is not granted perm, or whose API key lacks it as a
+// scope, get 403.
+func RequirePermission(perm auth.Permission) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if CurrentUser(c) == nil {
+			return Unauthorized(c, "Authentication required")
+		}
+
+		if !HasPermission(c, perm) {
+			return Forbidden(c, "You do not have permission to perform this action")
+		}
+
+		return c.Next()
+	}
+}
+
+// HasPermission reports whether the authenticated caller holds perm: the
+// user's role must grant it and, for API keys, the key must be scoped to it.
+func HasPermission(c *fiber.Ctx, perm auth.Permission) bool {
+	user := CurrentUser(c)
+	if user == nil || !auth.Can(user.Role, perm) {
+		return false
+	}
+
+	if key := CurrentAPIKey(c); key != nil && !auth.KeyAllows(key, perm) {
+		return false
+	}
+
+	return true
+}
+
+// Forbidden writes the 403 body shared by the RBAC checks.
+func Forbidden(c *fiber.Ctx, message string) error {
+	return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+		"ok":    false,
+		"error": message,
+	})
+}
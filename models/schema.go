@@ -6,6 +6,12 @@ import (
 	"github.com/google/uuid"
 )
 
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
 type User struct {
 	ID        uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
 	Email     string    `gorm:"unique;not null"`
@@ -13,8 +19,17 @@ type User struct {
 	Name      *string
 	Role      string `gorm:"default:user"`
 	Avatar    *string
+	AvatarKey *string `json:"-"`
 	CreatedAt time.Time
 	UpdatedAt time.Time
+
+	EmailVerifiedAt    *time.Time
+	VerificationSentAt *time.Time `json:"-"`
+	SessionVersion     int        `gorm:"not null;default:0" json:"-"`
+
+	TOTPSecret    *string    `gorm:"column:totp_secret" json:"-"`
+	TOTPEnabledAt *time.Time `gorm:"column:totp_enabled_at" json:"-"`
+	TOTPLastStep  int64      `gorm:"column:totp_last_step;not null;default:0" json:"-"`
 }
 
 type Product struct {
@@ -27,16 +42,75 @@ type Product struct {
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
 
-	Images []ProductImage `gorm:"foreignKey:ProductID"`
-	Review []Review       `gorm:"foreignKey:ProductID"`
+	// Filled only by queries that select them, e.g. the product listing.
+	AverageRating float64 `gorm:"->;-:migration"`
+	ReviewCount   int     `gorm:"->;-:migration"`
+
+	// SearchVector is written by controllers.indexProduct from
+	// search.Document of the name and description.
+	SearchVector string `gorm:"type:tsvector;index:idx_products_search,type:gin;->:false;<-:false" json:"-"`
+
+	Images     []ProductImage `gorm:"foreignKey:ProductID"`
+	Review     []Review       `gorm:"foreignKey:ProductID"`
+	Categories []Category     `gorm:"many2many:product_categories"`
+}
+
+// Category is a node in the product taxonomy. Top-level categories have
+// no parent; siblings are shown in Position order.
+type Category struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	ParentID  *uuid.UUID `gorm:"type:uuid;index"`
+	Name      string     `gorm:"not null"`
+	Slug      string     `gorm:"not null;uniqueIndex"`
+	Position  int        `gorm:"not null;default:0"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	Children []Category `gorm:"foreignKey:ParentID" json:",omitempty"`
 }
 
 type ProductImage struct {
+	ID          uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	ProductID   string    `gorm:"not null;uniqueIndex:idx_product_image_position"`
+	URL         string
+	ObjectKey   string
+	ContentHash string `gorm:"index"`
+	// PerceptualHash is imaging.DHash stored as a signed bigint.
+	PerceptualHash *int64 `json:"-"`
+	Width          int    `gorm:"not null;default:0"`
+	Height         int    `gorm:"not null;default:0"`
+	// BlurHash and DominantColor let clients draw a placeholder while
+	// the image loads.
+	BlurHash      string
+	DominantColor string
+	// NormalizedAt is set once the stored original has been through
+	// imaging.Normalize (orientation applied, metadata stripped).
+	NormalizedAt *time.Time `json:"-"`
+	// VariantFailures counts failed imageworker runs; images that keep
+	// failing are no longer queued on start.
+	VariantFailures int `gorm:"not null;default:0" json:"-"`
+	// VariantsVersion is the imageworker variant set the image was last
+	// processed with; older images are processed again on start.
+	VariantsVersion int `gorm:"not null;default:0" json:"-"`
+	Alt             *string
+	Position        int `gorm:"not null;uniqueIndex:idx_product_image_position"`
+
+	Variants []ProductImageVariant `gorm:"foreignKey:ImageID"`
+}
+
+// ProductImageVariant is a resized copy of a ProductImage, generated in
+// the background after upload.
+type ProductImageVariant struct {
 	ID        uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
-	ProductID string    `gorm:"not null"`
+	ImageID   uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_variant_image_name_format"`
+	Name      string    `gorm:"not null;uniqueIndex:idx_variant_image_name_format"`
+	Format    string    `gorm:"not null;uniqueIndex:idx_variant_image_name_format"`
+	Width     int
+	Height    int
+	Size      int64
+	ObjectKey string
 	URL       string
-	Alt       *string
-	Position  int
+	CreatedAt time.Time
 }
 
 type Review struct {
@@ -51,3 +125,77 @@ type Review struct {
 
 	User User `gorm:"foreignKey:UserID"`
 }
+
+type RefreshToken struct {
+	ID           uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	UserID       uuid.UUID `gorm:"type:uuid;not null;index"`
+	FamilyID     uuid.UUID `gorm:"type:uuid;not null;index"`
+	TokenHash    string    `gorm:"uniqueIndex;not null"`
+	ExpiresAt    time.Time `gorm:"not null"`
+	RevokedAt    *time.Time
+	ReplacedByID *uuid.UUID `gorm:"type:uuid"`
+	UserAgent    string
+	IP           string
+	CreatedAt    time.Time
+}
+
+type PasswordResetToken struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index"`
+	TokenHash string    `gorm:"uniqueIndex;not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+type RecoveryCode struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index"`
+	CodeHash  string    `gorm:"not null;index"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+type LoginThrottle struct {
+	Key           string    `gorm:"primaryKey"`
+	Failures      int       `gorm:"not null;default:0"`
+	LastFailureAt time.Time `gorm:"not null"`
+	LockedUntil   *time.Time
+	UpdatedAt     time.Time
+}
+
+// UserIdentity links a user to an account at an external OIDC provider.
+type UserIdentity struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index"`
+	Provider  string    `gorm:"not null;uniqueIndex:idx_identity_provider_subject"`
+	Subject   string    `gorm:"not null;uniqueIndex:idx_identity_provider_subject"`
+	Email     string
+	CreatedAt time.Time
+}
+
+// OAuthState holds the per-login PKCE verifier and nonce between the
+// redirect to the provider and the callback.
+type OAuthState struct {
+	ID           uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	StateHash    string     `gorm:"uniqueIndex;not null"`
+	Provider     string     `gorm:"not null"`
+	CodeVerifier string     `gorm:"not null"`
+	Nonce        string     `gorm:"not null"`
+	LinkUserID   *uuid.UUID `gorm:"type:uuid"`
+	ExpiresAt    time.Time  `gorm:"not null"`
+	CreatedAt    time.Time
+}
+
+type APIKey struct {
+	ID         uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	UserID     uuid.UUID `gorm:"type:uuid;not null;index"`
+	Name       string    `gorm:"not null"`
+	Prefix     string    `gorm:"uniqueIndex;not null"`
+	KeyHash    string    `gorm:"not null" json:"-"`
+	Scopes     []string  `gorm:"serializer:json"`
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+	CreatedAt  time.Time
+}
@@ -0,0 +1,187 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// IDClaims are the ID token claims we use for sign-in and linking.
+type IDClaims struct {
+	Email         string   `json:"email"`
+	EmailVerified flexBool `json:"email_verified"`
+	Name          string   `json:"name"`
+	Picture       string   `json:"picture"`
+	Nonce         string   `json:"nonce"`
+	jwt.RegisteredClaims
+}
+
+// flexBool accepts both true and "true"; some providers send a string.
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	*b = flexBool(s == "true")
+	return nil
+}
+
+type keySet struct {
+	keys      map[string]interface{}
+	fetchedAt time.Time
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// VerifyIDToken checks the signature (RS256/ES256 via the provider's JWKS,
+// or HS256 with the client secret), issuer, audience, expiry and nonce.
+func (p *Provider) VerifyIDToken(ctx context.Context, raw, nonce string) (*IDClaims, error) {
+	doc, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &IDClaims{}
+	_, err = jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (interface{}, error) {
+		if t.Method.Alg() == jwt.SigningMethodHS256.Alg() {
+			if p.ClientSecret == "" {
+				return nil, errors.New("HS256 id_token without client secret")
+			}
+			return []byte(p.ClientSecret), nil
+		}
+
+		kid, _ := t.Header["kid"].(string)
+		return p.publicKey(ctx, doc.JWKSURI, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "ES256", "HS256"}),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Issuer != p.Issuer {
+		return nil, fmt.Errorf("unexpected issuer %q", claims.Issuer)
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("id_token has no subject")
+	}
+	if claims.Nonce != nonce {
+		return nil, errors.New("nonce mismatch")
+	}
+
+	if p.TrustEmail && claims.Email != "" {
+		claims.EmailVerified = true
+	}
+
+	return claims, nil
+}
+
+// publicKey looks kid up in the cached JWKS, refetching at most once a
+// minute so rotated provider keys are picked up.
+func (p *Provider) publicKey(ctx context.Context, jwksURI, kid string) (interface{}, error) {
+	if jwksURI == "" {
+		return nil, errors.New("provider has no jwks_uri")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.keys != nil {
+		if key, ok := p.keys.keys[kid]; ok {
+			return key, nil
+		}
+		if time.Since(p.keys.fetchedAt) < time.Minute {
+			return nil, fmt.Errorf("unknown kid %q", kid)
+		}
+	}
+
+	var body struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := p.getJSON(ctx, jwksURI, &body); err != nil {
+		return nil, fmt.Errorf("jwks: %w", err)
+	}
+
+	set := &keySet{keys: map[string]interface{}{}, fetchedAt: time.Now()}
+	for _, k := range body.Keys {
+		key, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		set.keys[k.Kid] = key
+	}
+	p.keys = set
+
+	key, ok := set.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+	return key, nil
+}
+
+func (k jsonWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,332 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	mockClientID     = "mock-client"
+	mockClientSecret = "mock-secret"
+	mockRedirectURL  = "http://localhost:3000/api/auth/oidc/mock/callback"
+)
+
+// mockIssuer is a minimal OpenID provider: discovery, JWKS and a token
+// endpoint that checks PKCE. Tests play the browser by calling authorize
+// with the URL from AuthCodeURL instead of following a login page.
+type mockIssuer struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	// Overrides for misbehaving providers; empty means the server URL
+	// and the client ID.
+	discoveryIssuer string
+	tokenIssuer     string
+	tokenAudience   string
+
+	mu     sync.Mutex
+	grants map[string]mockGrant
+}
+
+type mockGrant struct {
+	challenge string
+	nonce     string
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &mockIssuer{key: key, grants: map[string]mockGrant{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", m.discovery)
+	mux.HandleFunc("/jwks", m.jwks)
+	mux.HandleFunc("/token", m.token)
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+	return m
+}
+
+func (m *mockIssuer) provider() *Provider {
+	return &Provider{
+		Name:         "mock",
+		Issuer:       m.URL,
+		ClientID:     mockClientID,
+		ClientSecret: mockClientSecret,
+		RedirectURL:  mockRedirectURL,
+		Scopes:       []string{"openid", "email"},
+		client:       m.Client(),
+	}
+}
+
+// authorize stands in for the login page: it records the PKCE challenge
+// and nonce of the authorization request and returns a one-time code.
+func (m *mockIssuer) authorize(t *testing.T, authURL string) string {
+	t.Helper()
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("client_id") != mockClientID || q.Get("redirect_uri") != mockRedirectURL {
+		t.Fatalf("unexpected authorization request %s", authURL)
+	}
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		t.Fatalf("authorization request without S256 PKCE: %s", authURL)
+	}
+
+	code, err := randomString(16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.mu.Lock()
+	m.grants[code] = mockGrant{challenge: q.Get("code_challenge"), nonce: q.Get("nonce")}
+	m.mu.Unlock()
+	return code
+}
+
+func (m *mockIssuer) discovery(w http.ResponseWriter, r *http.Request) {
+	issuer := m.discoveryIssuer
+	if issuer == "" {
+		issuer = m.URL
+	}
+	json.NewEncoder(w).Encode(map[string]string{
+		"issuer":                 issuer,
+		"authorization_endpoint": m.URL + "/authorize",
+		"token_endpoint":         m.URL + "/token",
+		"jwks_uri":               m.URL + "/jwks",
+	})
+}
+
+func (m *mockIssuer) jwks(w http.ResponseWriter, r *http.Request) {
+	pub := m.key.PublicKey
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "mock",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+func (m *mockIssuer) token(w http.ResponseWriter, r *http.Request) {
+	fail := func(code string) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": code})
+	}
+
+	if r.Method != http.MethodPost || r.ParseForm() != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		fail("invalid_request")
+		return
+	}
+	if r.PostForm.Get("client_id") != mockClientID || r.PostForm.Get("client_secret") != mockClientSecret {
+		fail("invalid_client")
+		return
+	}
+
+	// โค้ดใช้ได้ครั้งเดียว
+	m.mu.Lock()
+	grant, ok := m.grants[r.PostForm.Get("code")]
+	delete(m.grants, r.PostForm.Get("code"))
+	m.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || r.PostForm.Get("redirect_uri") != mockRedirectURL ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge {
+		fail("invalid_grant")
+		return
+	}
+
+	issuer, audience := m.tokenIssuer, m.tokenAudience
+	if issuer == "" {
+		issuer = m.URL
+	}
+	if audience == "" {
+		audience = mockClientID
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, IDClaims{
+		Email:         "somchai@example.com",
+		EmailVerified: true,
+		Nonce:         grant.nonce,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   "mock-user-1",
+			Audience:  jwt.ClaimStrings{audience},
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(5 * time.Minute)),
+		},
+	})
+	token.Header["kid"] = "mock"
+	idToken, err := token.SignedString(m.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"access_token": "mock-access-token",
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+	})
+}
+
+// signIn runs the code flow up to the raw ID token.
+func signIn(t *testing.T, m *mockIssuer, p *Provider) (idToken, nonce string) {
+	t.Helper()
+	ctx := context.Background()
+
+	nonce, err := RandomString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authURL, err := p.AuthCodeURL(ctx, "state", nonce, challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := m.authorize(t, authURL)
+
+	idToken, err = p.Exchange(ctx, code, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return idToken, nonce
+}
+
+func TestCodeFlow(t *testing.T) {
+	m := newMockIssuer(t)
+	p := m.provider()
+
+	idToken, nonce := signIn(t, m, p)
+	claims, err := p.VerifyIDToken(context.Background(), idToken, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "mock-user-1" || claims.Email != "somchai@example.com" || !bool(claims.EmailVerified) {
+		t.Errorf("claims = %+v", claims)
+	}
+}
+
+func TestExchangeRequiresMatchingVerifier(t *testing.T) {
+	m := newMockIssuer(t)
+	p := m.provider()
+	ctx := context.Background()
+
+	_, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherVerifier, _, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authURL, err := p.AuthCodeURL(ctx, "state", "nonce", challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := m.authorize(t, authURL)
+
+	if _, err := p.Exchange(ctx, code, otherVerifier); err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Fatalf("Exchange with wrong verifier: err = %v, want invalid_grant", err)
+	}
+}
+
+func TestExchangeCodeIsSingleUse(t *testing.T) {
+	m := newMockIssuer(t)
+	p := m.provider()
+	ctx := context.Background()
+
+	verifier, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	authURL, err := p.AuthCodeURL(ctx, "state", "nonce", challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := m.authorize(t, authURL)
+
+	if _, err := p.Exchange(ctx, code, verifier); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Exchange(ctx, code, verifier); err == nil {
+		t.Fatal("second exchange of the same code succeeded")
+	}
+}
+
+func TestVerifyIDTokenRejectsNonceMismatch(t *testing.T) {
+	m := newMockIssuer(t)
+	p := m.provider()
+
+	idToken, _ := signIn(t, m, p)
+	if _, err := p.VerifyIDToken(context.Background(), idToken, "another-nonce"); err == nil {
+		t.Fatal("token accepted with the wrong nonce")
+	}
+}
+
+func TestVerifyIDTokenRejectsIssuerAndAudience(t *testing.T) {
+	tests := []struct {
+		name     string
+		issuer   func(m *mockIssuer) string
+		audience string
+	}{
+		{"other issuer", func(*mockIssuer) string { return "https://evil.example" }, ""},
+		{"issuer without scheme", func(m *mockIssuer) string { return strings.TrimPrefix(m.URL, "http://") }, ""},
+		{"issuer with trailing slash", func(m *mockIssuer) string { return m.URL + "/" }, ""},
+		{"other audience", nil, "someone-else"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMockIssuer(t)
+			if tt.issuer != nil {
+				m.tokenIssuer = tt.issuer(m)
+			}
+			m.tokenAudience = tt.audience
+			p := m.provider()
+
+			idToken, nonce := signIn(t, m, p)
+			if _, err := p.VerifyIDToken(context.Background(), idToken, nonce); err == nil {
+				t.Fatal("token accepted")
+			}
+		})
+	}
+}
+
+func TestDiscoveryRejectsIssuerMismatch(t *testing.T) {
+	m := newMockIssuer(t)
+	m.discoveryIssuer = "https://evil.example"
+	p := m.provider()
+
+	if _, err := p.AuthCodeURL(context.Background(), "state", "nonce", "challenge"); err == nil {
+		t.Fatal("discovery document for another issuer was accepted")
+	}
+}
@@ -0,0 +1,246 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Provider is one OpenID Connect identity provider configured from env:
+//
+//	OIDC_PROVIDERS               comma separated names, e.g. "google,line"
+//	OIDC_<NAME>_ISSUER           issuer URL (google and line have defaults)
+//	OIDC_<NAME>_CLIENT_ID
+//	OIDC_<NAME>_CLIENT_SECRET
+//	OIDC_<NAME>_REDIRECT_URL     our callback, .../api/auth/oidc/<name>/callback
+//	OIDC_<NAME>_SCOPES           default "openid email profile"
+//	OIDC_<NAME>_TRUST_EMAIL      "true" when the provider only issues verified
+//	                             emails but does not send email_verified
+//
+// The issuer can point at a local mock provider for development and tests.
+type Provider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	TrustEmail   bool
+
+	client *http.Client
+
+	mu        sync.Mutex
+	discovery *discoveryDocument
+	keys      *keySet
+}
+
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+var defaultIssuers = map[string]string{
+	"google": "https://accounts.google.com",
+	"line":   "https://access.line.me",
+}
+
+var providers = map[string]*Provider{}
+
+// Init loads the providers listed in OIDC_PROVIDERS.
+func Init() {
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		issuer := os.Getenv(prefix + "ISSUER")
+		if issuer == "" {
+			issuer = defaultIssuers[name]
+		}
+
+		scopes := strings.Fields(os.Getenv(prefix + "SCOPES"))
+		if len(scopes) == 0 {
+			scopes = []string{"openid", "email", "profile"}
+		}
+
+		p := &Provider{
+			Name:         name,
+			Issuer:       strings.TrimRight(issuer, "/"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+			Scopes:       scopes,
+			TrustEmail:   os.Getenv(prefix+"TRUST_EMAIL") == "true",
+			client:       &http.Client{Timeout: 10 * time.Second},
+		}
+
+		if p.Issuer == "" || p.ClientID == "" || p.RedirectURL == "" {
+			log.Fatalf("❌ OIDC provider %q needs ISSUER, CLIENT_ID and REDIRECT_URL", name)
+		}
+
+		providers[name] = p
+		log.Printf("✅ OIDC provider %s enabled", name)
+	}
+}
+
+// Get returns a configured provider by name.
+func Get(name string) (*Provider, bool) {
+	p, ok := providers[name]
+	return p, ok
+}
+
+// NewPKCE returns a code verifier and its S256 challenge (RFC 7636).
+func NewPKCE() (verifier, challenge string, err error) {
+	verifier, err = randomString(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// RandomString is used for state and nonce values.
+func RandomString() (string, error) {
+	return randomString(32)
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func (p *Provider) discover(ctx context.Context) (*discoveryDocument, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var doc discoveryDocument
+	if err := p.getJSON(ctx, p.Issuer+"/.well-known/openid-configuration", &doc); err != nil {
+		return nil, fmt.Errorf("discovery: %w", err)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" {
+		return nil, errors.New("discovery: missing endpoints")
+	}
+	// OpenID Connect Discovery 1.0 §4.3: the document must name exactly
+	// the issuer it was fetched from.
+	if doc.Issuer != p.Issuer {
+		return nil, fmt.Errorf("discovery: issuer %q does not match %q", doc.Issuer, p.Issuer)
+	}
+
+	p.discovery = &doc
+	return p.discovery, nil
+}
+
+// AuthCodeURL builds the authorization request for the code flow with PKCE.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	doc, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.ClientID)
+	q.Set("redirect_uri", p.RedirectURL)
+	q.Set("scope", strings.Join(p.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", codeChallenge)
+	q.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(doc.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return doc.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange trades the authorization code for tokens and returns the raw ID token.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier string) (string, error) {
+	doc, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("client_id", p.ClientID)
+	form.Set("client_secret", p.ClientSecret)
+	form.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, doc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return "", fmt.Errorf("token endpoint: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK || body.Error != "" {
+		return "", fmt.Errorf("token endpoint: %s %s", body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return "", errors.New("token endpoint: no id_token in response")
+	}
+
+	return body.IDToken, nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, endpoint string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", endpoint, resp.Status)
+	}
+
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
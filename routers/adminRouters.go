@@ -0,0 +1,25 @@
+package routers
+
+import (
+	"review-products/auth"
+	"review-products/controllers"
+	"review-products/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func AdminRoutes(app *fiber.App) {
+	admin := app.Group("/api/admin")
+	manageUsers := middleware.RequireScopedAuth(auth.PermUserManage)
+	manageProducts := middleware.RequireScopedAuth(auth.PermProductWrite)
+	manageCategories := middleware.RequireScopedAuth(auth.PermCategoryManage)
+
+	admin.Patch("/users/:id/role", manageUsers, controllers.UpdateUserRole)
+	admin.Post("/users/:id/unlock", manageUsers, controllers.UnlockUser)
+	admin.Get("/images/duplicates", manageProducts, controllers.NearDuplicateImages)
+
+	admin.Post("/categories", manageCategories, controllers.CreateCategory)
+	admin.Patch("/categories/:id", manageCategories, controllers.UpdateCategory)
+	admin.Delete("/categories/:id", manageCategories, controllers.DeleteCategory)
+	admin.Put("/products/:id/categories", manageCategories, controllers.SetProductCategories)
+}
@@ -0,0 +1,15 @@
+package routers
+
+import (
+	"review-products/controllers"
+	"review-products/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func APIKeyRoutes(app *fiber.App) {
+	keys := app.Group("/api/api-keys", middleware.RequireAuth)
+	keys.Post("/", controllers.CreateAPIKey)
+	keys.Get("/", controllers.ListAPIKeys)
+	keys.Delete("/:id", controllers.RevokeAPIKey)
+}
@@ -2,11 +2,29 @@ package routers
 
 import (
 	"review-products/controllers"
+	"review-products/middleware"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 func AuthRoutes(app *fiber.App) {
+	app.Get("/.well-known/jwks.json", controllers.JWKSHandler)
 	app.Post("/api/auth/login", controllers.LoginHandler)
 	app.Post("/api/auth/register", controllers.RegisterHandler)
+	app.Post("/api/auth/refresh", controllers.RefreshHandler)
+	app.Post("/api/auth/logout", controllers.LogoutHandler)
+	app.Post("/api/auth/forgot-password", controllers.ForgotPasswordHandler)
+	app.Post("/api/auth/reset-password", controllers.ResetPasswordHandler)
+	app.Get("/api/auth/verify-email", controllers.VerifyEmailHandler)
+	app.Post("/api/auth/resend-verification", middleware.RequireAuth, controllers.ResendVerificationHandler)
+	app.Post("/api/auth/logout-all", middleware.RequireAuth, controllers.LogoutAllHandler)
+
+	app.Get("/api/auth/oidc/:provider/start", controllers.OIDCStartHandler)
+	app.Get("/api/auth/oidc/:provider/callback", controllers.OIDCCallbackHandler)
+	app.Post("/api/auth/oidc/:provider/link", middleware.RequireAuth, controllers.OIDCLinkHandler)
+
+	app.Post("/api/auth/mfa/verify", controllers.VerifyMFAHandler)
+	app.Post("/api/auth/mfa/enroll", middleware.RequireAuth, controllers.EnrollMFAHandler)
+	app.Post("/api/auth/mfa/confirm", middleware.RequireAuth, controllers.ConfirmMFAHandler)
+	app.Post("/api/auth/mfa/disable", middleware.RequireAuth, controllers.DisableMFAHandler)
 }
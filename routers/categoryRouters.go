@@ -0,0 +1,11 @@
+package routers
+
+import (
+	"review-products/controllers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func CategoryRoutes(app *fiber.App) {
+	app.Get("/api/categories", controllers.GetCategories)
+}
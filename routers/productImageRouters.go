@@ -1,11 +1,20 @@
 package routers
 
 import (
+	"review-products/auth"
 	"review-products/controllers"
+	"review-products/middleware"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 func ProductImageRoutes(app *fiber.App) {
-	app.Post("/api/upload-image-product", controllers.UploadProductImage)
+	canWrite := middleware.RequireScopedAuth(auth.PermProductWrite)
+
+	app.Post("/api/upload-image-product", canWrite, controllers.UploadProductImage)
+	app.Get("/api/images/:id/:variant", controllers.ServeImage)
+	app.Post("/api/products/:id/images", canWrite, controllers.UploadProductImageFiles)
+	app.Put("/api/products/:id/images/order", canWrite, controllers.ReorderProductImages)
+	app.Patch("/api/products/:id/images/:imageId", canWrite, controllers.UpdateProductImage)
+	app.Delete("/api/products/:id/images/:imageId", canWrite, controllers.DeleteProductImage)
 }
@@ -1,15 +1,20 @@
 package routers
 
 import (
+	"review-products/auth"
 	"review-products/controllers"
+	"review-products/middleware"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 func ProductRoutes(app *fiber.App) {
+	canWrite := middleware.RequireScopedAuth(auth.PermProductWrite)
+
 	app.Get("/api/all-product", controllers.GetAllProducts)
 	app.Get("/api/product", controllers.GetProductById)
-	app.Post("/api/product/create", controllers.CreateProduct)
-	app.Patch("/api/product/update", controllers.UpdateProduct)
-	app.Delete("/api/product/delete", controllers.DeleteProduct)
+	app.Get("/api/products/search", controllers.SearchProducts)
+	app.Post("/api/product/create", canWrite, controllers.CreateProduct)
+	app.Patch("/api/product/update", canWrite, controllers.UpdateProduct)
+	app.Delete("/api/product/delete", canWrite, controllers.DeleteProduct)
 }
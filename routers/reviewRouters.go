@@ -1,15 +1,19 @@
 package routers
 
 import (
+	"review-products/auth"
 	"review-products/controllers"
+	"review-products/middleware"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 func ReviewRouters(app *fiber.App) {
+	canWrite := middleware.RequireScopedAuth(auth.PermReviewWrite)
+
 	app.Get("/api/all-reviews", controllers.GetAllReviews)
 	app.Get("/api/review", controllers.GetReviewByProductId)
-	app.Post("/api/add-review", controllers.CreateReview)
-	app.Patch("/api/update-review", controllers.UpdateReview)
-	app.Delete("/api/delete-review", controllers.DeleteReview)
+	app.Post("/api/add-review", canWrite, middleware.RequireVerifiedEmail, controllers.CreateReview)
+	app.Patch("/api/update-review", canWrite, controllers.UpdateReview)
+	app.Delete("/api/delete-review", canWrite, controllers.DeleteReview)
 }
@@ -0,0 +1,22 @@
+package routers
+
+import (
+	"strings"
+
+	"review-products/storage"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// StorageRoutes serves uploaded files when they live on local disk under a
+// path on this server (rather than a CDN URL).
+func StorageRoutes(app *fiber.App) {
+	local, ok := storage.Default.(*storage.Local)
+	if !ok || !strings.HasPrefix(local.PublicURL, "/") {
+		return
+	}
+
+	app.Static(local.PublicURL, local.Root, fiber.Static{
+		MaxAge: 31536000,
+	})
+}
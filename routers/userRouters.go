@@ -2,10 +2,12 @@ package routers
 
 import (
 	"review-products/controllers"
+	"review-products/middleware"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 func UserRouter(app *fiber.App) {
+	app.Post("/api/user/avatar", middleware.RequireAuth, controllers.UploadAvatar)
 	app.Get("/api/user/:id", controllers.GetUser)
 }
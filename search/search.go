@@ -0,0 +1,176 @@
+// Package search prepares text for Postgres full-text search.
+//
+// Postgres has no Thai dictionary and Thai is written without spaces, so
+// the "simple" parser would index a whole Thai phrase as one word. Instead
+// each run of Thai characters is split into overlapping two-character
+// tokens (character bigrams): "กาแฟสด" becomes "กา าแ แฟ ฟส สด". A query is
+// split the same way and every token must match, which finds a Thai word
+// anywhere inside a longer phrase. Other scripts are split into lowercase
+// words as usual.
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+func isThai(r rune) bool {
+	return r >= 0x0E01 && r <= 0x0E4E
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r)
+}
+
+// run is a maximal stretch of Thai or of other word characters.
+type run struct {
+	text string
+	thai bool
+}
+
+func runs(text string) []run {
+	var out []run
+	var current []rune
+	currentThai := false
+
+	flush := func() {
+		if len(current) > 0 {
+			out = append(out, run{text: string(current), thai: currentThai})
+			current = current[:0]
+		}
+	}
+
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case isThai(r):
+			if !currentThai {
+				flush()
+			}
+			currentThai = true
+			current = append(current, r)
+		case isWordRune(r):
+			if currentThai {
+				flush()
+			}
+			currentThai = false
+			current = append(current, r)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return out
+}
+
+// Tokens splits text into index tokens: lowercase words, and bigrams for
+// Thai. A single Thai character stays a token of its own.
+func Tokens(text string) []string {
+	var tokens []string
+	for _, r := range runs(text) {
+		if !r.thai {
+			tokens = append(tokens, r.text)
+			continue
+		}
+
+		chars := []rune(r.text)
+		if len(chars) == 1 {
+			tokens = append(tokens, r.text)
+			continue
+		}
+		for i := 0; i+1 < len(chars); i++ {
+			tokens = append(tokens, string(chars[i:i+2]))
+		}
+	}
+	return tokens
+}
+
+// Document is the text to pass to to_tsvector('simple', ...).
+func Document(text string) string {
+	return strings.Join(Tokens(text), " ")
+}
+
+// Query builds a to_tsquery('simple', ...) expression requiring every token
+// of q. The last token also matches as a prefix, so results appear while
+// the user is still typing; for Thai that lets a single character or a
+// half-typed bigram match the bigrams in the index. It returns "" when q
+// has nothing searchable.
+func Query(q string) string {
+	var parts []string
+	for _, token := range Tokens(q) {
+		parts = append(parts, "'"+token+"'")
+	}
+	if len(parts) > 0 {
+		parts[len(parts)-1] += ":*"
+	}
+	return strings.Join(parts, " & ")
+}
+
+// Highlight HTML-escapes text and wraps case-insensitive occurrences of
+// the words in q with <mark>. When maxRunes > 0 and text is longer, it is
+// cut to a window around the first match.
+func Highlight(text, q string, maxRunes int) string {
+	var terms [][]rune
+	for _, r := range runs(q) {
+		terms = append(terms, []rune(r.text))
+	}
+
+	chars := []rune(text)
+	lower := []rune(strings.ToLower(text))
+	if len(lower) != len(chars) {
+		// ตัวอักษรบางตัวเปลี่ยนความยาวเมื่อเป็นตัวเล็ก ใช้ข้อความเดิมเทียบแทน
+		lower = chars
+	}
+
+	marked := make([]bool, len(chars))
+	first := -1
+	for _, term := range terms {
+		for i := 0; i+len(term) <= len(lower); i++ {
+			if !equalRunes(lower[i:i+len(term)], term) {
+				continue
+			}
+			for j := i; j < i+len(term); j++ {
+				marked[j] = true
+			}
+			if first == -1 || i < first {
+				first = i
+			}
+		}
+	}
+
+	start, end := 0, len(chars)
+	if maxRunes > 0 && len(chars) > maxRunes {
+		if first > maxRunes/3 {
+			start = first - maxRunes/3
+		}
+		end = min(len(chars), start+maxRunes)
+		start = max(0, end-maxRunes)
+	}
+
+	var sb strings.Builder
+	if start > 0 {
+		sb.WriteString("…")
+	}
+	for i := start; i < end; i++ {
+		if marked[i] && (i == start || !marked[i-1]) {
+			sb.WriteString("<mark>")
+		}
+		sb.WriteString(html.EscapeString(string(chars[i])))
+		if marked[i] && (i == end-1 || !marked[i+1]) {
+			sb.WriteString("</mark>")
+		}
+	}
+	if end < len(chars) {
+		sb.WriteString("…")
+	}
+	return sb.String()
+}
+
+func equalRunes(a, b []rune) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
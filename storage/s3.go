@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"context"
+	"io"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3 stores objects in an S3-compatible bucket (AWS S3, MinIO, R2, ...).
+type S3 struct {
+	Bucket    string
+	PublicURL string
+
+	client *minio.Client
+}
+
+type S3Config struct {
+	Endpoint  string
+	AccessKey string
+	SecretKey string
+	Bucket    string
+	Region    string
+	UseSSL    bool
+	// PublicURL is where objects are downloaded from, e.g. a CDN in front
+	// of the bucket. Defaults to <endpoint>/<bucket>.
+	PublicURL string
+}
+
+// NewS3 connects to the endpoint and creates the bucket if it is missing,
+// which keeps a fresh local MinIO usable without manual setup.
+func NewS3(ctx context.Context, cfg S3Config) (*S3, error) {
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	exists, err := client.BucketExists(ctx, cfg.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, cfg.Bucket, minio.MakeBucketOptions{Region: cfg.Region}); err != nil {
+			return nil, err
+		}
+	}
+
+	publicURL := cfg.PublicURL
+	if publicURL == "" {
+		scheme := "http://"
+		if cfg.UseSSL {
+			scheme = "https://"
+		}
+		publicURL = scheme + cfg.Endpoint + "/" + cfg.Bucket
+	}
+
+	return &S3{Bucket: cfg.Bucket, PublicURL: publicURL, client: client}, nil
+}
+
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	_, err := s.client.PutObject(ctx, s.Bucket, key, r, size, minio.PutObjectOptions{
+		ContentType:  contentType,
+		CacheControl: "public, max-age=31536000, immutable",
+	})
+	return err
+}
+
+func (s *S3) Get(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+	obj, err := s.client.GetObject(ctx, s.Bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	// GetObject is lazy; Stat makes a missing key fail here instead of on
+	// the first Read.
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return obj, nil
+}
+
+func (s *S3) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := s.client.StatObject(ctx, s.Bucket, key, minio.StatObjectOptions{})
+	if err == nil {
+		return true, nil
+	}
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return false, nil
+	}
+	return false, err
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	return s.client.RemoveObject(ctx, s.Bucket, key, minio.RemoveObjectOptions{})
+}
+
+func (s *S3) URL(key string) string {
+	return joinURL(s.PublicURL, key)
+}
@@ -0,0 +1,255 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 answers the path-style requests minio-go makes for the calls S3
+// uses: bucket HEAD/PUT and object PUT, GET, HEAD and DELETE. GET and HEAD
+// go through http.ServeContent, so Range requests behave like S3.
+type fakeS3 struct {
+	mu      sync.Mutex
+	buckets map[string]map[string]fakeObject
+}
+
+type fakeObject struct {
+	data        []byte
+	contentType string
+	modified    time.Time
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, string) {
+	t.Helper()
+
+	f := &fakeS3{buckets: map[string]map[string]fakeObject{}}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, strings.TrimPrefix(srv.URL, "http://")
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	objects, ok := f.buckets[bucket]
+	if key == "" {
+		switch {
+		case r.Method == http.MethodPut:
+			if !ok {
+				f.buckets[bucket] = map[string]fakeObject{}
+			}
+		case r.Method == http.MethodHead && !ok:
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method != http.MethodHead:
+			s3Error(w, http.StatusNotImplemented, "NotImplemented")
+		}
+		return
+	}
+	if !ok {
+		s3Error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		data, err := readPayload(r)
+		if err != nil {
+			s3Error(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		objects[key] = fakeObject{data: data, contentType: r.Header.Get("Content-Type"), modified: time.Now().UTC()}
+		w.Header().Set("ETag", etag(data))
+
+	case http.MethodGet, http.MethodHead:
+		obj, ok := objects[key]
+		if !ok {
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			s3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("ETag", etag(obj.data))
+		w.Header().Set("Content-Type", obj.contentType)
+		http.ServeContent(w, r, key, obj.modified, bytes.NewReader(obj.data))
+
+	case http.MethodDelete:
+		delete(objects, key)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		s3Error(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+// readPayload decodes aws-chunked bodies ("<hex size>;chunk-signature=...\r\n
+// <data>\r\n", ending with a zero-size chunk and optional trailers) and
+// reads plain bodies as is.
+func readPayload(r *http.Request) ([]byte, error) {
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return io.ReadAll(r.Body)
+	}
+
+	var out bytes.Buffer
+	br := bufio.NewReader(r.Body)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return out.Bytes(), nil
+		}
+		if _, err := io.CopyN(&out, br, size); err != nil {
+			return nil, err
+		}
+		if _, err := br.Discard(2); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func etag(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func s3Error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>%s</Code><Message>%s</Message></Error>`, code, code)
+}
+
+func newTestS3(t *testing.T) (*S3, *fakeS3) {
+	t.Helper()
+
+	fake, endpoint := newFakeS3(t)
+	s, err := NewS3(context.Background(), S3Config{
+		Endpoint:  endpoint,
+		AccessKey: "test-access",
+		SecretKey: "test-secret",
+		Bucket:    "products",
+		// ตั้ง region ไว้ minio จะได้ไม่ถาม bucket location
+		Region: "us-east-1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, fake
+}
+
+func TestS3CreatesMissingBucket(t *testing.T) {
+	s, fake := newTestS3(t)
+
+	if _, ok := fake.buckets["products"]; !ok {
+		t.Fatal("bucket was not created")
+	}
+	if got, want := s.URL("products/a.jpg"), "http://"+s.client.EndpointURL().Host+"/products/products/a.jpg"; got != want {
+		t.Errorf("URL = %s, want %s", got, want)
+	}
+}
+
+func TestS3PutGetExistsDelete(t *testing.T) {
+	s, fake := newTestS3(t)
+	ctx := context.Background()
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+
+	if err := s.Put(ctx, "products/a.jpg", bytes.NewReader(data), int64(len(data)), "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+	if obj := fake.buckets["products"]["products/a.jpg"]; !bytes.Equal(obj.data, data) || obj.contentType != "image/jpeg" {
+		t.Fatalf("stored %d bytes as %q", len(obj.data), obj.contentType)
+	}
+
+	exists, err := s.Exists(ctx, "products/a.jpg")
+	if err != nil || !exists {
+		t.Fatalf("Exists = %v, %v", exists, err)
+	}
+
+	r, err := s.Get(ctx, "products/a.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("Get returned %d bytes, want %d", len(got), len(data))
+	}
+
+	if err := s.Delete(ctx, "products/a.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	exists, err = s.Exists(ctx, "products/a.jpg")
+	if err != nil || exists {
+		t.Fatalf("Exists after Delete = %v, %v", exists, err)
+	}
+}
+
+func TestS3GetRange(t *testing.T) {
+	s, _ := newTestS3(t)
+	ctx := context.Background()
+	data := []byte("abcdefghijklmnopqrstuvwxyz")
+
+	if err := s.Put(ctx, "k", bytes.NewReader(data), int64(len(data)), "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := s.Get(ctx, "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil || size != int64(len(data)) {
+		t.Fatalf("size = %d, %v", size, err)
+	}
+	if _, err := r.Seek(20, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(io.LimitReader(r, 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "uvwx" {
+		t.Fatalf("range read = %q, want %q", got, "uvwx")
+	}
+}
+
+func TestS3MissingObject(t *testing.T) {
+	s, _ := newTestS3(t)
+	ctx := context.Background()
+
+	if _, err := s.Get(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get missing: err = %v, want ErrNotFound", err)
+	}
+	exists, err := s.Exists(ctx, "missing")
+	if err != nil || exists {
+		t.Fatalf("Exists missing = %v, %v", exists, err)
+	}
+}